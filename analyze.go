@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charleskorn/query-log-analysis/parser"
+)
+
+// analysisReport aggregates the histograms the "analyze" subcommand reports on: range query
+// duration, step size, evaluation-point count (duration/step, ie. how many samples the engine has
+// to evaluate per request), and staleness (the lag between a query's log timestamp and the end of
+// the time range, or instant, it queried).
+type analysisReport struct {
+	duration  *histogram[time.Duration]
+	step      *histogram[time.Duration]
+	points    *histogram[int64]
+	staleness *histogram[time.Duration]
+}
+
+func newAnalysisReport(topN int) *analysisReport {
+	return &analysisReport{
+		duration:  newHistogram(durationBucketBoundaries(), topN),
+		step:      newHistogram(durationBucketBoundaries(), topN),
+		points:    newHistogram(pointBucketBoundaries(), topN),
+		staleness: newHistogram(durationBucketBoundaries(), topN),
+	}
+}
+
+// Observe records the shape of line against r. Only range and instant queries have a duration/step
+// shape worth reporting on; other kinds (series, labels, label_values, exemplars, remote_read) are
+// ignored.
+func (r *analysisReport) Observe(line parser.LogLine) {
+	switch line.Kind {
+	case parser.QueryKindRange:
+		duration := line.QueryEndTime.Sub(line.QueryStartTime)
+		r.duration.Observe(duration, line.Query)
+		r.staleness.Observe(line.Timestamp.Sub(line.QueryEndTime), line.Query)
+
+		if line.QueryStep > 0 {
+			r.step.Observe(line.QueryStep, line.Query)
+			r.points.Observe(int64(duration/line.QueryStep), line.Query)
+		}
+
+	case parser.QueryKindInstant:
+		r.staleness.Observe(line.Timestamp.Sub(line.QueryTime), line.Query)
+	}
+}
+
+// runAnalyze implements the "analyze" subcommand: it profiles the shape of the queries in the log
+// files named by args, inspired by promtool's histogram analysis, so operators can see which part
+// of a workload (eg. a long tail of 30d-range, 10s-step queries) is driving evaluation cost.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "number of log lines to analyse concurrently")
+	logFormat := fs.String("log-format", "", "format of the log lines being analysed: prometheus or loki (default: auto-detect from the first line)")
+	topN := fs.Int("top", 5, "number of queries to report per histogram bucket (0 to disable)")
+	output := fs.String("output", "query-shapes.txt", "path to write the query-shape report to")
+	sentinelModeFlag := fs.String("sentinel-mode", "clamp", "how to handle query log lines with a Prometheus MinTime/MaxTime (or similarly out-of-range) timestamp: clamp, drop or keep")
+	sentinelMinFlag := fs.String("sentinel-min", defaultSentinelBounds().Min.Format(time.RFC3339), "the earliest timestamp considered a real query time, rather than a sentinel")
+	sentinelMaxFlag := fs.String("sentinel-max", defaultSentinelBounds().Max.Format(time.RFC3339), "the latest timestamp considered a real query time, rather than a sentinel")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		return errors.New("no paths specified")
+	}
+
+	opts, err := ingestOptionsFromFlags(*logFormat, *sentinelModeFlag, *sentinelMinFlag, *sentinelMaxFlag)
+	if err != nil {
+		return err
+	}
+
+	report := newAnalysisReport(*topN)
+
+	for _, path := range paths {
+		slog.Info("Analysing query shapes in file", "path", path)
+
+		if err := analyzeFile(path, report, *concurrency, opts); err != nil {
+			return fmt.Errorf("analysing file %v failed: %w", path, err)
+		}
+	}
+
+	slog.Info("Query-shape analysis complete")
+
+	return writeAnalysisReport(*output, report)
+}
+
+// analyzeFile reads path one line at a time and fans parsed log lines out to a pool of
+// concurrency workers, each calling report.Observe. This mirrors analyseFile's structure, but
+// there's no PromQL execution involved, so the only failures come from decoding.
+func analyzeFile(path string, report *analysisReport, concurrency int, opts ingestOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+
+	defer f.Close()
+
+	lines := make(chan parser.LogLine, concurrency)
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for l := range lines {
+				report.Observe(l)
+			}
+		}()
+	}
+
+	var decoder parser.Decoder
+
+	readErr := readLines(f, func(line string) error {
+		if decoder == nil {
+			decoder, err = resolveDecoder(opts.format, line)
+			if err != nil {
+				return err
+			}
+		}
+
+		parsed, err := decoder.Decode([]byte(line))
+		if err != nil {
+			if errors.Is(err, parser.ErrSkipLine) {
+				return nil
+			}
+
+			return fmt.Errorf("parsing log line '%v' failed: %w", line, err)
+		}
+
+		parsed, keep := normalizeSentinelTimes(parsed, opts.sentinelMode, opts.sentinelBounds)
+		if !keep {
+			return nil
+		}
+
+		lines <- parsed
+
+		return nil
+	})
+
+	close(lines)
+	wg.Wait()
+
+	return readErr
+}
+
+// writeAnalysisReport writes a human-readable summary of report's four histograms to path.
+func writeAnalysisReport(path string, report *analysisReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create query-shape report: %w", err)
+	}
+
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	if err := report.duration.WriteReport(w, "Range query duration (queryEndTime - queryStartTime)", time.Duration.String); err != nil {
+		return err
+	}
+
+	if err := report.step.WriteReport(w, "Step size", time.Duration.String); err != nil {
+		return err
+	}
+
+	if err := report.points.WriteReport(w, "Evaluation points per request (duration / step)", formatInt64); err != nil {
+		return err
+	}
+
+	if err := report.staleness.WriteReport(w, "Staleness (timestamp - queryEndTime/queryTime)", time.Duration.String); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func formatInt64(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// blockLayoutConfig describes the tiers of block width that a Mimir/Thanos cluster queries
+// through as data ages: the ingester holds the most recent IngesterRetention of data, attributed
+// at hourly granularity, after which the store-gateway serves
+// progressively larger compacted blocks (CompactionRanges), settling on LongTermBlockSize once the
+// compactor has finished merging blocks for good.
+type blockLayoutConfig struct {
+	IngesterRetention          time.Duration   `yaml:"ingester_retention"`
+	CompactionRanges           []time.Duration `yaml:"compaction_ranges"`
+	LongTermBlockSize          time.Duration   `yaml:"long_term_block_size"`
+	LookbackDelta              time.Duration   `yaml:"lookback_delta"`
+	QueryFrontendSplitInterval time.Duration   `yaml:"query_frontend_split_interval"`
+	TotalRetention             time.Duration   `yaml:"total_retention"`
+}
+
+// defaultBlockLayoutConfig matches Mimir's current defaults: a 13h ingester retention, blocks
+// compacted from 2h to 12h to 24h, and 24h blocks beyond that up to a total retention of 395 days.
+func defaultBlockLayoutConfig() blockLayoutConfig {
+	return blockLayoutConfig{
+		IngesterRetention:          13 * time.Hour,
+		CompactionRanges:           []time.Duration{2 * time.Hour, 12 * time.Hour, 24 * time.Hour},
+		LongTermBlockSize:          24 * time.Hour,
+		LookbackDelta:              5 * time.Minute,
+		QueryFrontendSplitInterval: 24 * time.Hour,
+		TotalRetention:             395 * 24 * time.Hour,
+	}
+}
+
+// loadBlockLayoutConfig reads a blockLayoutConfig from a YAML file at path, if path is non-empty,
+// falling back to defaultBlockLayoutConfig otherwise.
+func loadBlockLayoutConfig(path string) (blockLayoutConfig, error) {
+	config := defaultBlockLayoutConfig()
+
+	if path == "" {
+		return config, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return blockLayoutConfig{}, fmt.Errorf("could not read block layout config: %w", err)
+	}
+
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return blockLayoutConfig{}, fmt.Errorf("could not parse block layout config: %w", err)
+	}
+
+	return config, nil
+}
+
+// blockLayout turns a blockLayoutConfig into a concrete, ordered list of bucket boundaries (each a
+// distance "ago" from the time the query was run), so that a select can be attributed to whichever
+// tier (ingester, recently-compacted store-gateway block, or long-term store-gateway block) it
+// actually reads from.
+type blockLayout struct {
+	config blockLayoutConfig
+
+	// boundaries holds the distance-ago, in ascending order, marking the start of each bucket.
+	// Bucket i spans [boundaries[i], boundaries[i+1]).
+	boundaries []time.Duration
+}
+
+func newBlockLayout(config blockLayoutConfig) *blockLayout {
+	boundaries := []time.Duration{0}
+	current := time.Duration(0)
+
+	// The ingester holds the most recent data. Mimir's query-frontend splits queries into
+	// QueryFrontendSplitInterval-sized requests, but within that the ingester itself is queried
+	// as a whole, so attribute this tier hour-by-hour to preserve today's resolution for the
+	// data operators care most about.
+	for current < config.IngesterRetention {
+		current += time.Hour
+		boundaries = append(boundaries, current)
+	}
+
+	// Recently-compacted store-gateway blocks: the compactor progressively merges blocks from
+	// one width to the next (e.g. 2h -> 12h -> 24h), so a select in this tier touches one block
+	// of each configured width as it ages through the compaction pipeline.
+	for _, width := range config.CompactionRanges {
+		if width <= 0 || current >= config.TotalRetention {
+			continue
+		}
+
+		current += width
+		boundaries = append(boundaries, current)
+	}
+
+	// Long-term store-gateway blocks: once the compactor has finished, blocks stay at a fixed
+	// width for the rest of the retention period.
+	if config.LongTermBlockSize > 0 {
+		for current < config.TotalRetention {
+			current += config.LongTermBlockSize
+			boundaries = append(boundaries, current)
+		}
+	}
+
+	return &blockLayout{config: config, boundaries: boundaries}
+}
+
+// numBuckets returns the number of buckets in the layout.
+func (l *blockLayout) numBuckets() int {
+	return len(l.boundaries) - 1
+}
+
+// bucketRange returns the [start, end) range covered by bucket i.
+func (l *blockLayout) bucketRange(i int) (start, end time.Duration) {
+	return l.boundaries[i], l.boundaries[i+1]
+}
+
+// bucketIndex returns the index of the bucket containing d, or -1 if d is at or beyond the layout's
+// total retention.
+func (l *blockLayout) bucketIndex(d time.Duration) int {
+	i := sort.Search(len(l.boundaries)-1, func(i int) bool {
+		return l.boundaries[i+1] > d
+	})
+
+	if i >= l.numBuckets() || d >= l.config.TotalRetention {
+		return -1
+	}
+
+	return i
+}
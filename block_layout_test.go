@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockLayoutDefaultBoundaries(t *testing.T) {
+	l := newBlockLayout(defaultBlockLayoutConfig())
+
+	requireBucket := func(i int, wantStart, wantEnd time.Duration) {
+		start, end := l.bucketRange(i)
+		require.Equal(t, wantStart, start, "bucket %d start", i)
+		require.Equal(t, wantEnd, end, "bucket %d end", i)
+	}
+
+	// Ingester tier: hourly buckets for the first 13h.
+	for i := 0; i < 13; i++ {
+		requireBucket(i, time.Duration(i)*time.Hour, time.Duration(i+1)*time.Hour)
+	}
+
+	// Recent compaction tiers: one bucket per configured range, widening each time.
+	requireBucket(13, 13*time.Hour, 15*time.Hour)
+	requireBucket(14, 15*time.Hour, 27*time.Hour)
+	requireBucket(15, 27*time.Hour, 51*time.Hour)
+
+	// Long-term tier: fixed-width buckets thereafter.
+	requireBucket(16, 51*time.Hour, 75*time.Hour)
+	requireBucket(17, 75*time.Hour, 99*time.Hour)
+}
+
+func TestBlockLayoutBucketIndex(t *testing.T) {
+	l := newBlockLayout(defaultBlockLayoutConfig())
+
+	require.Equal(t, 0, l.bucketIndex(0))
+	require.Equal(t, 0, l.bucketIndex(59*time.Minute))
+	require.Equal(t, 12, l.bucketIndex(12*time.Hour))
+	require.Equal(t, 13, l.bucketIndex(13*time.Hour))
+	require.Equal(t, 13, l.bucketIndex(14*time.Hour))
+	require.Equal(t, 14, l.bucketIndex(15*time.Hour))
+	require.Equal(t, 15, l.bucketIndex(30*time.Hour))
+	require.Equal(t, -1, l.bucketIndex(defaultBlockLayoutConfig().TotalRetention))
+}
+
+func TestBlockLayoutNumBuckets(t *testing.T) {
+	l := newBlockLayout(defaultBlockLayoutConfig())
+
+	// Sanity check: the last bucket should start within the configured total retention and end
+	// beyond it, so the layout covers the whole retention period.
+	start, end := l.bucketRange(l.numBuckets() - 1)
+	require.LessOrEqual(t, start, defaultBlockLayoutConfig().TotalRetention)
+	require.Greater(t, end, defaultBlockLayoutConfig().TotalRetention)
+}
+
+func TestLoadBlockLayoutConfigDefaultsWhenNoPath(t *testing.T) {
+	config, err := loadBlockLayoutConfig("")
+	require.NoError(t, err)
+	require.Equal(t, defaultBlockLayoutConfig(), config)
+}
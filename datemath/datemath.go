@@ -0,0 +1,105 @@
+// Package datemath parses Grafana-style relative time expressions, such as "now-1h" or
+// "now-7d/d", as used by Grafana's time picker and Loki's query API.
+package datemath
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// exprPattern matches "now", followed by zero or more signed offsets, followed by an optional
+// "/unit" snap-to-start-of-unit suffix.
+var exprPattern = regexp.MustCompile(`^now((?:[+-]\d+[smhdwMy])*)(?:/([smhdwMy]))?$`)
+
+var offsetPattern = regexp.MustCompile(`([+-])(\d+)([smhdwMy])`)
+
+// Parse evaluates expr relative to the current time. expr must be "now", optionally followed by
+// one or more signed offsets (eg. "now-1h", "now-7d+2h") and a trailing "/unit" that truncates the
+// result to the start of that unit (eg. "now-7d/d"). Units are s(econds), m(inutes), h(ours),
+// d(ays), w(eeks), M(onths) and y(ears); offsets are applied left to right.
+//
+// Parse rejects anything that isn't datemath, including RFC3339 timestamps and Unix floats; use
+// parser.ParseTime for those.
+func Parse(expr string) (time.Time, error) {
+	return parseAt(expr, time.Now().UTC())
+}
+
+func parseAt(expr string, now time.Time) (time.Time, error) {
+	m := exprPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("%q is not a valid datemath expression", expr)
+	}
+
+	t := now
+
+	for _, offset := range offsetPattern.FindAllStringSubmatch(m[1], -1) {
+		sign, amountStr, unit := offset[1], offset[2], offset[3]
+
+		amount, err := strconv.Atoi(amountStr)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a valid datemath expression: %w", expr, err)
+		}
+
+		if sign == "-" {
+			amount = -amount
+		}
+
+		t = applyOffset(t, amount, unit)
+	}
+
+	if snapUnit := m[2]; snapUnit != "" {
+		t = truncateToUnit(t, snapUnit)
+	}
+
+	return t, nil
+}
+
+// applyOffset advances t by amount units, using calendar arithmetic for day/week/month/year
+// offsets so that eg. "now-1M" means "this time last month" rather than a fixed 30*24h.
+func applyOffset(t time.Time, amount int, unit string) time.Time {
+	switch unit {
+	case "s":
+		return t.Add(time.Duration(amount) * time.Second)
+	case "m":
+		return t.Add(time.Duration(amount) * time.Minute)
+	case "h":
+		return t.Add(time.Duration(amount) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, amount)
+	case "w":
+		return t.AddDate(0, 0, amount*7)
+	case "M":
+		return t.AddDate(0, amount, 0)
+	case "y":
+		return t.AddDate(amount, 0, 0)
+	default:
+		return t
+	}
+}
+
+// truncateToUnit snaps t to the start of the given unit, in UTC.
+func truncateToUnit(t time.Time, unit string) time.Time {
+	switch unit {
+	case "s":
+		return t.Truncate(time.Second)
+	case "m":
+		return t.Truncate(time.Minute)
+	case "h":
+		return t.Truncate(time.Hour)
+	case "d":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case "w":
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		// ISO weeks start on Monday; time.Weekday numbers Sunday as 0.
+		daysSinceMonday := (int(d.Weekday()) + 6) % 7
+		return d.AddDate(0, 0, -daysSinceMonday)
+	case "M":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "y":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
@@ -0,0 +1,64 @@
+package datemath
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAt(t *testing.T) {
+	now := time.Date(2023, 11, 13, 9, 20, 30, 0, time.UTC) // A Monday.
+
+	testCases := map[string]struct {
+		expr     string
+		expected time.Time
+	}{
+		"now":                   {"now", now},
+		"simple hour offset":    {"now-1h", now.Add(-time.Hour)},
+		"simple minute offset":  {"now-15m", now.Add(-15 * time.Minute)},
+		"positive offset":       {"now+1h", now.Add(time.Hour)},
+		"chained offsets":       {"now-1d+2h", now.AddDate(0, 0, -1).Add(2 * time.Hour)},
+		"month offset":          {"now-1M", now.AddDate(0, -1, 0)},
+		"year offset":           {"now-1y", now.AddDate(-1, 0, 0)},
+		"snap to day":           {"now/d", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		"snap to hour":          {"now/h", time.Date(2023, 11, 13, 9, 0, 0, 0, time.UTC)},
+		"snap to month":         {"now/M", time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)},
+		"snap to year":          {"now/y", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"snap to week (Monday)": {"now/w", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		"offset then snap":      {"now-7d/d", time.Date(2023, 11, 6, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := parseAt(testCase.expr, now)
+			require.NoError(t, err)
+			require.True(t, testCase.expected.Equal(actual), "expected %v, got %v", testCase.expected, actual)
+		})
+	}
+}
+
+func TestParseAtSnapToWeekMidweek(t *testing.T) {
+	now := time.Date(2023, 11, 16, 14, 0, 0, 0, time.UTC) // A Thursday.
+
+	actual, err := parseAt("now/w", now)
+	require.NoError(t, err)
+	require.True(t, time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC).Equal(actual))
+}
+
+func TestParseAtRejectsNonDatemathExpressions(t *testing.T) {
+	testCases := []string{
+		"",
+		"1699867200",
+		"2023-11-13T09:20:00Z",
+		"nowish",
+		"now-1x",
+	}
+
+	for _, expr := range testCases {
+		t.Run(expr, func(t *testing.T) {
+			_, err := parseAt(expr, time.Now())
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Package filter builds the query-log-line filter shared by this repo's binaries (the main
+// analysis tool and query-shapes-details), so the flags and matching logic they expose stay in
+// lockstep instead of drifting between two copies.
+package filter
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/charleskorn/query-log-analysis/datemath"
+	"github.com/charleskorn/query-log-analysis/parser"
+)
+
+// Filter decides whether a parsed log line should be included in analysis.
+type Filter interface {
+	Matches(l parser.LogLine) bool
+}
+
+// filters is a composable Filter that matches only if every filter in the slice matches.
+type filters []Filter
+
+func (fs filters) Matches(l parser.LogLine) bool {
+	for _, f := range fs {
+		if !f.Matches(l) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type metricMatchFilter struct {
+	re *regexp.Regexp
+}
+
+func (f metricMatchFilter) Matches(l parser.LogLine) bool {
+	return f.re.MatchString(l.Query)
+}
+
+type rangeDurationFilter struct {
+	min, max time.Duration // Zero means unbounded.
+}
+
+func (f rangeDurationFilter) Matches(l parser.LogLine) bool {
+	if l.Kind != parser.QueryKindRange {
+		return true
+	}
+
+	d := l.QueryEndTime.Sub(l.QueryStartTime)
+
+	if f.min > 0 && d < f.min {
+		return false
+	}
+
+	if f.max > 0 && d > f.max {
+		return false
+	}
+
+	return true
+}
+
+type queryTypeFilter struct {
+	kind parser.QueryKind
+}
+
+func (f queryTypeFilter) Matches(l parser.LogLine) bool {
+	return l.Kind == f.kind
+}
+
+type timeWindowFilter struct {
+	since, until time.Time // Zero means unbounded.
+}
+
+func (f timeWindowFilter) Matches(l parser.LogLine) bool {
+	if !f.since.IsZero() && l.Timestamp.Before(f.since) {
+		return false
+	}
+
+	if !f.until.IsZero() && l.Timestamp.After(f.until) {
+		return false
+	}
+
+	return true
+}
+
+type userMatchFilter struct {
+	re *regexp.Regexp
+}
+
+func (f userMatchFilter) Matches(l parser.LogLine) bool {
+	return f.re.MatchString(l.User)
+}
+
+// timestampFlag is a flag.Value that accepts a Grafana-style datemath expression (eg. "now-1h",
+// "now-7d/d") or, failing that, any format parser.ParseTime accepts (RFC3339Nano or a Unix
+// timestamp), so -since/-from and -until/-to can be given in whichever form is most convenient.
+type timestampFlag struct {
+	t time.Time
+}
+
+func (f *timestampFlag) String() string {
+	if f.t.IsZero() {
+		return ""
+	}
+
+	return f.t.Format(time.RFC3339)
+}
+
+func (f *timestampFlag) Set(s string) error {
+	if t, err := datemath.Parse(s); err == nil {
+		f.t = t
+		return nil
+	}
+
+	t, err := parser.ParseTime(s)
+	if err != nil {
+		return err
+	}
+
+	f.t = t
+
+	return nil
+}
+
+var (
+	matchMetricFlag = flag.String("match-metric", "", "only include queries whose text matches this regex")
+	minRangeFlag    = flag.Duration("min-range", 0, "only include range queries spanning at least this duration")
+	maxRangeFlag    = flag.Duration("max-range", 0, "only include range queries spanning at most this duration")
+	queryTypeFlag   = flag.String("query-type", "", "only include queries of this type: instant, range, series, labels, label_values, exemplars or remote_read")
+	userFlag        = flag.String("user", "", "only include queries issued by a user matching this regex")
+	sinceFlag       timestampFlag
+	untilFlag       timestampFlag
+)
+
+func init() {
+	const timeUsage = "accepts RFC3339, a Unix timestamp, or Grafana-style datemath such as 'now-1h' or 'now-7d/d'"
+
+	flag.Var(&sinceFlag, "since", "only include queries logged at or after this time ("+timeUsage+")")
+	flag.Var(&untilFlag, "until", "only include queries logged at or before this time ("+timeUsage+")")
+
+	// -from/-to are aliases for -since/-until, matching the naming Grafana and Loki use for the
+	// same concept.
+	flag.Var(&sinceFlag, "from", "alias for -since")
+	flag.Var(&untilFlag, "to", "alias for -until")
+}
+
+// Build constructs a Filter from the -match-metric, -min-range, -max-range, -query-type,
+// -since/-from, -until/-to and -user flags registered by this package. Flags left at their zero
+// value impose no restriction. Lines outside the [-since, -until] window are filtered out before
+// any aggregation work happens, so it's cheap to analyse a narrow slice of a multi-day capture.
+func Build() (Filter, error) {
+	var fs filters
+
+	if *matchMetricFlag != "" {
+		re, err := regexp.Compile(*matchMetricFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -match-metric regex: %w", err)
+		}
+
+		fs = append(fs, metricMatchFilter{re: re})
+	}
+
+	if *minRangeFlag > 0 || *maxRangeFlag > 0 {
+		fs = append(fs, rangeDurationFilter{min: *minRangeFlag, max: *maxRangeFlag})
+	}
+
+	if *queryTypeFlag != "" {
+		kind, err := parser.ParseQueryKind(*queryTypeFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -query-type: %w", err)
+		}
+
+		fs = append(fs, queryTypeFilter{kind: kind})
+	}
+
+	if !sinceFlag.t.IsZero() || !untilFlag.t.IsZero() {
+		fs = append(fs, timeWindowFilter{since: sinceFlag.t, until: untilFlag.t})
+	}
+
+	if *userFlag != "" {
+		re, err := regexp.Compile(*userFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -user regex: %w", err)
+		}
+
+		fs = append(fs, userMatchFilter{re: re})
+	}
+
+	return fs, nil
+}
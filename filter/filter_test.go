@@ -0,0 +1,112 @@
+package filter
+
+import (
+	"flag"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/charleskorn/query-log-analysis/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineFilters(t *testing.T) {
+	base := time.Date(2023, 11, 13, 9, 20, 0, 0, time.UTC)
+
+	rangeLine := parser.LogLine{
+		Timestamp:      base,
+		Query:          `rate(metric_a{job="x"}[5m])`,
+		User:           "alice",
+		Kind:           parser.QueryKindRange,
+		QueryStartTime: base.Add(-time.Hour),
+		QueryEndTime:   base,
+	}
+
+	instantLine := parser.LogLine{
+		Timestamp: base,
+		Query:     `metric_b{}`,
+		User:      "bob",
+		Kind:      parser.QueryKindInstant,
+		QueryTime: base,
+	}
+
+	t.Run("metricMatchFilter", func(t *testing.T) {
+		f := metricMatchFilter{re: regexp.MustCompile("metric_a")}
+		require.True(t, f.Matches(rangeLine))
+		require.False(t, f.Matches(instantLine))
+	})
+
+	t.Run("rangeDurationFilter", func(t *testing.T) {
+		f := rangeDurationFilter{min: 30 * time.Minute, max: 2 * time.Hour}
+		require.True(t, f.Matches(rangeLine))
+		require.True(t, f.Matches(instantLine), "filter should not affect instant queries")
+
+		require.False(t, rangeDurationFilter{min: 2 * time.Hour}.Matches(rangeLine))
+		require.False(t, rangeDurationFilter{max: 30 * time.Minute}.Matches(rangeLine))
+	})
+
+	t.Run("queryTypeFilter", func(t *testing.T) {
+		require.True(t, queryTypeFilter{kind: parser.QueryKindRange}.Matches(rangeLine))
+		require.False(t, queryTypeFilter{kind: parser.QueryKindRange}.Matches(instantLine))
+		require.True(t, queryTypeFilter{kind: parser.QueryKindInstant}.Matches(instantLine))
+	})
+
+	t.Run("timeWindowFilter", func(t *testing.T) {
+		f := timeWindowFilter{since: base.Add(-time.Minute), until: base.Add(time.Minute)}
+		require.True(t, f.Matches(rangeLine))
+		require.False(t, timeWindowFilter{since: base.Add(time.Minute)}.Matches(rangeLine))
+		require.False(t, timeWindowFilter{until: base.Add(-time.Minute)}.Matches(rangeLine))
+	})
+
+	t.Run("userMatchFilter", func(t *testing.T) {
+		f := userMatchFilter{re: regexp.MustCompile("^alice$")}
+		require.True(t, f.Matches(rangeLine))
+		require.False(t, f.Matches(instantLine))
+	})
+
+	t.Run("filters combines with AND", func(t *testing.T) {
+		fs := filters{
+			queryTypeFilter{kind: parser.QueryKindRange},
+			userMatchFilter{re: regexp.MustCompile("^bob$")},
+		}
+		require.False(t, fs.Matches(rangeLine), "range query doesn't match the user filter")
+		require.False(t, fs.Matches(instantLine), "instant query doesn't match the query-type filter")
+	})
+}
+
+func TestTimestampFlagSet(t *testing.T) {
+	t.Run("datemath expression", func(t *testing.T) {
+		before := time.Now().UTC()
+		var f timestampFlag
+		require.NoError(t, f.Set("now-1h"))
+		after := time.Now().UTC()
+
+		require.True(t, !f.t.Before(before.Add(-time.Hour)) && !f.t.After(after.Add(-time.Hour)),
+			"expected %v to be about 1h before %v and %v", f.t, before, after)
+	})
+
+	t.Run("RFC3339 timestamp", func(t *testing.T) {
+		var f timestampFlag
+		require.NoError(t, f.Set("2023-11-13T09:20:00Z"))
+		require.True(t, f.t.Equal(time.Date(2023, 11, 13, 9, 20, 0, 0, time.UTC)))
+	})
+
+	t.Run("Unix timestamp", func(t *testing.T) {
+		var f timestampFlag
+		require.NoError(t, f.Set("1700000000"))
+		require.True(t, f.t.Equal(time.Unix(1700000000, 0).UTC()))
+	})
+
+	t.Run("invalid expression", func(t *testing.T) {
+		var f timestampFlag
+		require.Error(t, f.Set("not a time"))
+	})
+}
+
+// TestFromToAliasSinceUntil confirms -from/-to are registered against the same sinceFlag/untilFlag
+// as -since/-until, rather than just happening to parse the same syntax, so the two pairs can never
+// silently drift apart.
+func TestFromToAliasSinceUntil(t *testing.T) {
+	require.Same(t, flag.Lookup("since").Value, flag.Lookup("from").Value, "-from should be the same flag.Value as -since")
+	require.Same(t, flag.Lookup("until").Value, flag.Lookup("to").Value, "-to should be the same flag.Value as -until")
+}
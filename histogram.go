@@ -0,0 +1,210 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// histogramSample is one observation recorded against a histogram, tagged with the query that
+// produced it, so the largest queries in each bucket can be reported.
+type histogramSample[T cmp.Ordered] struct {
+	value T
+	query string
+}
+
+// histogramBucket holds every observation whose value fell in (previous boundary, upperBound]. The
+// last bucket in a histogram has hasUpperBound == false, covering (previous boundary, +Inf).
+type histogramBucket[T cmp.Ordered] struct {
+	upperBound    T
+	hasUpperBound bool
+	count         int64
+	top           []histogramSample[T] // The topN largest samples seen in this bucket, descending.
+}
+
+// histogram tracks observations of a single ordered, duration-or-count-like metric (eg. query
+// duration, step size, evaluation-point count) against a fixed set of boundaries, so reports built
+// from different log captures use the same buckets and are directly comparable. It also retains
+// the topN largest-valued queries observed in each bucket, for drilling into what's driving it.
+type histogram[T cmp.Ordered] struct {
+	mu         sync.Mutex
+	boundaries []T // Ascending, shared with every bucket but buckets[i].
+	samples    []T // Every observation, kept to compute percentiles at report time.
+	buckets    []histogramBucket[T]
+	topN       int
+}
+
+func newHistogram[T cmp.Ordered](boundaries []T, topN int) *histogram[T] {
+	buckets := make([]histogramBucket[T], len(boundaries)+1)
+	for i, b := range boundaries {
+		buckets[i] = histogramBucket[T]{upperBound: b, hasUpperBound: true}
+	}
+
+	return &histogram[T]{boundaries: boundaries, buckets: buckets, topN: topN}
+}
+
+// Observe records that query produced value.
+func (h *histogram[T]) Observe(value T, query string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples = append(h.samples, value)
+
+	// The smallest index whose boundary is >= value; len(boundaries) if none is, which lands in
+	// the trailing +Inf bucket.
+	i, _ := slices.BinarySearch(h.boundaries, value)
+
+	b := &h.buckets[i]
+	b.count++
+	b.recordTop(histogramSample[T]{value: value, query: query}, h.topN)
+}
+
+func (b *histogramBucket[T]) recordTop(s histogramSample[T], topN int) {
+	if topN <= 0 {
+		return
+	}
+
+	b.top = append(b.top, s)
+	slices.SortFunc(b.top, func(a, c histogramSample[T]) int { return cmp.Compare(c.value, a.value) })
+
+	if len(b.top) > topN {
+		b.top = b.top[:topN]
+	}
+}
+
+// histogramSummary is a point-in-time snapshot of a histogram's percentiles and bucket contents,
+// ready for reporting.
+type histogramSummary[T cmp.Ordered] struct {
+	count              int64
+	p50, p90, p99, max T
+	buckets            []histogramBucket[T]
+}
+
+// Summarize returns a snapshot of h's current state. Safe to call concurrently with Observe, but
+// the result reflects a single point in time, not a running total.
+func (h *histogram[T]) Summarize() histogramSummary[T] {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sorted := append([]T(nil), h.samples...)
+	slices.Sort(sorted)
+
+	buckets := make([]histogramBucket[T], len(h.buckets))
+	for i, b := range h.buckets {
+		b.top = append([]histogramSample[T](nil), b.top...)
+		buckets[i] = b
+	}
+
+	summary := histogramSummary[T]{
+		count:   int64(len(sorted)),
+		buckets: buckets,
+	}
+
+	if len(sorted) == 0 {
+		return summary
+	}
+
+	summary.p50 = percentile(sorted, 0.50)
+	summary.p90 = percentile(sorted, 0.90)
+	summary.p99 = percentile(sorted, 0.99)
+	summary.max = sorted[len(sorted)-1]
+
+	return summary
+}
+
+// percentile returns the nearest-rank value at p (0-1) of sorted, which must be sorted ascending
+// and non-empty.
+func percentile[T any](sorted []T, p float64) T {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+
+	return sorted[i]
+}
+
+// WriteReport writes a human-readable summary of h to w: overall percentiles, then one line per
+// non-empty bucket with its count and, if h was configured with topN > 0, the largest queries
+// observed in it. format renders a single value of T (eg. "1m30s" for a duration, "120" for a
+// point count).
+func (h *histogram[T]) WriteReport(w io.Writer, name string, format func(T) string) error {
+	summary := h.Summarize()
+
+	if summary.count == 0 {
+		_, err := fmt.Fprintf(w, "%s: no samples\n\n", name)
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "%s: count=%d p50=%s p90=%s p99=%s max=%s\n",
+		name, summary.count, format(summary.p50), format(summary.p90), format(summary.p99), format(summary.max)); err != nil {
+		return err
+	}
+
+	for _, b := range summary.buckets {
+		if b.count == 0 {
+			continue
+		}
+
+		label := "+Inf"
+		if b.hasUpperBound {
+			label = "<=" + format(b.upperBound)
+		}
+
+		if _, err := fmt.Fprintf(w, "  %s: %d\n", label, b.count); err != nil {
+			return err
+		}
+
+		for _, s := range b.top {
+			if _, err := fmt.Fprintf(w, "    %s\t%s\n", format(s.value), s.query); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+
+	return err
+}
+
+// durationBucketBoundaries returns power-of-two-second boundaries from 1s up to just over 30 days,
+// so duration-valued histograms are comparable across runs regardless of the workload analysed.
+func durationBucketBoundaries() []time.Duration {
+	const max = 30 * 24 * time.Hour
+
+	var boundaries []time.Duration
+	for b := time.Second; ; b *= 2 {
+		boundaries = append(boundaries, b)
+
+		if b >= max {
+			break
+		}
+	}
+
+	return boundaries
+}
+
+// pointBucketBoundaries returns power-of-two boundaries from 1 up to the number of 1s steps in
+// just over 30 days, so the evaluation-point histogram spans the same dynamic range as the
+// duration-valued ones.
+func pointBucketBoundaries() []int64 {
+	const max = int64(30 * 24 * time.Hour / time.Second)
+
+	var boundaries []int64
+	for b := int64(1); ; b *= 2 {
+		boundaries = append(boundaries, b)
+
+		if b >= max {
+			break
+		}
+	}
+
+	return boundaries
+}
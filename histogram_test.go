@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramObserveAndSummarize(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, 2)
+
+	h.Observe(500*time.Millisecond, "a")
+	h.Observe(time.Second, "b")
+	h.Observe(3*time.Second, "c")
+	h.Observe(3*time.Second, "d")
+	h.Observe(10*time.Second, "e")
+
+	summary := h.Summarize()
+
+	require.Equal(t, int64(5), summary.count)
+	require.Equal(t, 10*time.Second, summary.max)
+
+	require.Len(t, summary.buckets, 4) // 3 boundaries + trailing +Inf bucket.
+
+	require.Equal(t, int64(2), summary.buckets[0].count) // <=1s: 500ms, 1s
+	require.Equal(t, int64(0), summary.buckets[1].count) // <=2s: none
+	require.Equal(t, int64(2), summary.buckets[2].count) // <=4s: 3s, 3s
+	require.Equal(t, int64(1), summary.buckets[3].count) // +Inf: 10s
+	require.False(t, summary.buckets[3].hasUpperBound)
+
+	require.Len(t, summary.buckets[2].top, 2)
+	require.Equal(t, "c", summary.buckets[2].top[0].query)
+}
+
+func TestHistogramTopNIsBoundedAndDescending(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Minute}, 2)
+
+	h.Observe(1*time.Second, "slowest-3rd")
+	h.Observe(5*time.Second, "slowest-1st")
+	h.Observe(3*time.Second, "slowest-2nd")
+
+	summary := h.Summarize()
+
+	require.Len(t, summary.buckets[0].top, 2)
+	require.Equal(t, "slowest-1st", summary.buckets[0].top[0].query)
+	require.Equal(t, "slowest-2nd", summary.buckets[0].top[1].query)
+}
+
+func TestHistogramWriteReport(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Second}, 1)
+	h.Observe(500*time.Millisecond, "fast query")
+	h.Observe(2*time.Second, "slow query")
+
+	var sb strings.Builder
+	require.NoError(t, h.WriteReport(&sb, "test histogram", time.Duration.String))
+
+	out := sb.String()
+	require.Contains(t, out, "test histogram: count=2")
+	require.Contains(t, out, "<=1s: 1")
+	require.Contains(t, out, "+Inf: 1")
+	require.Contains(t, out, "slow query")
+}
+
+func TestHistogramWriteReportWithNoSamples(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Second}, 1)
+
+	var sb strings.Builder
+	require.NoError(t, h.WriteReport(&sb, "empty histogram", time.Duration.String))
+
+	require.Equal(t, "empty histogram: no samples\n\n", sb.String())
+}
+
+func TestDurationBucketBoundariesSpanUpToAround30Days(t *testing.T) {
+	boundaries := durationBucketBoundaries()
+
+	require.Equal(t, time.Second, boundaries[0])
+	require.Less(t, boundaries[len(boundaries)-1], 60*24*time.Hour)
+	require.GreaterOrEqual(t, boundaries[len(boundaries)-1], 30*24*time.Hour)
+}
+
+func TestPointBucketBoundariesMatchDurationRange(t *testing.T) {
+	boundaries := pointBucketBoundaries()
+
+	require.Equal(t, int64(1), boundaries[0])
+	require.Equal(t, len(durationBucketBoundaries()), len(boundaries))
+}
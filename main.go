@@ -7,6 +7,8 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/charleskorn/query-log-analysis/filter"
+	"github.com/charleskorn/query-log-analysis/parser"
 	"github.com/go-kit/log"
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/promql"
@@ -14,12 +16,84 @@ import (
 	"log/slog"
 	"math"
 	"os"
+	"runtime"
+	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+var (
+	rateResolution        = flag.Duration("rate-resolution", defaultRateResolution, "width of each bucket in the query rate time series")
+	maxRateBuckets        = flag.Int("rate-max-buckets", defaultMaxRateBuckets, "maximum number of rate buckets to retain before downsampling older ones")
+	rateOverTimeOutput    = flag.String("rate-over-time-output", "rate-over-time.csv", "path to write the query rate time series CSV to")
+	concurrency           = flag.Int("concurrency", runtime.NumCPU(), "number of log lines to analyse concurrently")
+	perTenant             = flag.Bool("per-tenant", false, "also emit a per-tenant breakdown of query/select counts, based on the org_id of each query")
+	blockLayoutConfigPath = flag.String("block-layout-config", "", "path to a YAML file describing the cluster's ingester retention and block compaction schedule (defaults to Mimir's current defaults if not given)")
+	logFormat             = flag.String("log-format", "", "format of the log lines being analysed: prometheus or loki (default: auto-detect from the first line)")
+	sentinelModeFlag      = flag.String("sentinel-mode", "clamp", "how to handle query log lines with a Prometheus MinTime/MaxTime (or similarly out-of-range) timestamp: clamp, drop or keep")
+	sentinelMinFlag       = flag.String("sentinel-min", defaultSentinelBounds().Min.Format(time.RFC3339), "the earliest timestamp considered a real query time, rather than a sentinel")
+	sentinelMaxFlag       = flag.String("sentinel-max", defaultSentinelBounds().Max.Format(time.RFC3339), "the latest timestamp considered a real query time, rather than a sentinel")
+)
+
+// ingestOptions bundles the settings that control how a raw log line becomes a parser.LogLine
+// that's safe to filter and aggregate: which format to decode it as, and how to handle Prometheus
+// MinTime/MaxTime (or similarly out-of-range) sentinel timestamps. Shared by analyseFile,
+// replayFile and analyzeFile.
+type ingestOptions struct {
+	format         parser.Format
+	sentinelMode   sentinelMode
+	sentinelBounds sentinelBounds
+}
+
+// ingestOptionsFromFlags builds an ingestOptions from the given flag values, which are passed in
+// rather than read directly from the package-level flags so that the "replay" and "analyze"
+// subcommands, which parse their own flag sets, can reuse this.
+func ingestOptionsFromFlags(logFormat, sentinelMode, sentinelMin, sentinelMax string) (ingestOptions, error) {
+	mode, err := parseSentinelMode(sentinelMode)
+	if err != nil {
+		return ingestOptions{}, err
+	}
+
+	min, err := parser.ParseTime(sentinelMin)
+	if err != nil {
+		return ingestOptions{}, fmt.Errorf("invalid -sentinel-min: %w", err)
+	}
+
+	max, err := parser.ParseTime(sentinelMax)
+	if err != nil {
+		return ingestOptions{}, fmt.Errorf("invalid -sentinel-max: %w", err)
+	}
+
+	return ingestOptions{
+		format:         parser.Format(logFormat),
+		sentinelMode:   mode,
+		sentinelBounds: sentinelBounds{Min: min, Max: max},
+	}, nil
+}
+
 func main() {
+	// The "replay" and "analyze" subcommands each parse their own flags, since their flag sets are
+	// unrelated to the analysis flags below.
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			slog.Error("Replay failed", "err", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		if err := runAnalyze(os.Args[2:]); err != nil {
+			slog.Error("Analysis failed", "err", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	if err := run(); err != nil {
 		slog.Error("Application failed", "err", err)
 		os.Exit(1)
@@ -34,12 +108,27 @@ func run() error {
 		return errors.New("no paths specified")
 	}
 
-	stats := newStatistics()
+	lineFilter, err := filter.Build()
+	if err != nil {
+		return err
+	}
+
+	opts, err := ingestOptionsFromFlags(*logFormat, *sentinelModeFlag, *sentinelMinFlag, *sentinelMaxFlag)
+	if err != nil {
+		return err
+	}
+
+	layoutConfig, err := loadBlockLayoutConfig(*blockLayoutConfigPath)
+	if err != nil {
+		return err
+	}
+
+	stats := newStatistics(newBlockLayout(layoutConfig))
 
 	for _, path := range paths {
 		slog.Info("Analysing file", "path", path)
 
-		if err := analyseFile(path, stats); err != nil {
+		if err := analyseFile(path, stats, *concurrency, lineFilter, opts); err != nil {
 			return fmt.Errorf("analysing file %v failed: %w", path, err)
 		}
 	}
@@ -51,8 +140,8 @@ func run() error {
 		return err
 	}
 
-	err := stats.ForBlockRanges(func(start time.Duration, count int64) error {
-		return w.Write([]string{formatBlockDuration(start), strconv.FormatInt(count, 10)})
+	err = stats.ForBlockRanges(func(start, end time.Duration, count int64) error {
+		return w.Write([]string{formatBlockDuration(start, end), strconv.FormatInt(count, 10)})
 	})
 
 	if err != nil {
@@ -63,13 +152,136 @@ func run() error {
 		return err
 	}
 
+	if err := w.Write(nil); err != nil {
+		return err
+	}
+
+	if err := w.Write([]string{"Query", "Annotation", "Count"}); err != nil {
+		return err
+	}
+
+	err = stats.ForAnnotations(func(query, annotation string, count int64) error {
+		return w.Write([]string{query, annotation, strconv.FormatInt(count, 10)})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := w.Write(nil); err != nil {
+		return err
+	}
+
+	if err := w.Write([]string{"Query kind", "Count"}); err != nil {
+		return err
+	}
+
+	err = stats.ForKindCounts(func(kind parser.QueryKind, count int64) error {
+		return w.Write([]string{kind.String(), strconv.FormatInt(count, 10)})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if *perTenant {
+		if err := writePerTenantStats(w, stats); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return writeRateOverTimeCSV(*rateOverTimeOutput, stats)
+}
+
+// writePerTenantStats appends a tenants-by-query-count summary, followed by one Range/Select-count
+// section per tenant (in the same format as the top-level one), to w.
+func writePerTenantStats(w *csv.Writer, stats *statistics) error {
+	stats.tenantsMu.RLock()
+	tenants := make([]string, 0, len(stats.tenants))
+	for t := range stats.tenants {
+		tenants = append(tenants, t)
+	}
+	stats.tenantsMu.RUnlock()
+
+	sort.Slice(tenants, func(i, j int) bool {
+		return stats.tenants[tenants[i]].queryCount.Load() > stats.tenants[tenants[j]].queryCount.Load()
+	})
+
+	if err := w.Write(nil); err != nil {
+		return err
+	}
+
+	if err := w.Write([]string{"Tenant", "Total queries"}); err != nil {
+		return err
+	}
+
+	for _, tenant := range tenants {
+		c := stats.tenants[tenant]
+
+		if err := w.Write([]string{tenant, strconv.FormatInt(c.queryCount.Load(), 10)}); err != nil {
+			return err
+		}
+	}
+
+	for _, tenant := range tenants {
+		c := stats.tenants[tenant]
+
+		if err := w.Write(nil); err != nil {
+			return err
+		}
+
+		if err := w.Write([]string{fmt.Sprintf("Tenant %v: Range", tenant), "Select count"}); err != nil {
+			return err
+		}
+
+		err := c.ForBlockRanges(func(start, end time.Duration, count int64) error {
+			return w.Write([]string{formatBlockDuration(start, end), strconv.FormatInt(count, 10)})
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeRateOverTimeCSV writes the query rate time series tracked by stats to path, in a separate
+// CSV file so it can be plotted without needing to skip over the per-block-range summary above.
+func writeRateOverTimeCSV(path string, stats *statistics) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create rate-over-time CSV: %w", err)
+	}
+
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"bucket_start", "resolution", "queries", "selects"}); err != nil {
+		return err
+	}
+
+	err = stats.rates.ForBuckets(func(start time.Time, resolution time.Duration, queries, selects int64) error {
+		return w.Write([]string{start.Format(time.RFC3339), resolution.String(), strconv.FormatInt(queries, 10), strconv.FormatInt(selects, 10)})
+	})
+
+	if err != nil {
+		return err
+	}
+
 	w.Flush()
 
 	return w.Error()
 }
 
-func formatBlockDuration(start time.Duration) string {
-	return fmt.Sprintf("%v-%v", formatDuration(start), formatDuration(start+time.Hour))
+func formatBlockDuration(start, end time.Duration) string {
+	return fmt.Sprintf("%v-%v", formatDuration(start), formatDuration(end))
 }
 
 func formatDuration(d time.Duration) string {
@@ -79,57 +291,102 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%vd%vh", days, hours)
 }
 
-type statistics struct {
+// queryCounters holds the query/select totals and per-block-range select counts that are tracked
+// both globally and, if the log lines identify a tenant, per-tenant.
+type queryCounters struct {
 	queryCount  atomic.Int64
 	selectCount atomic.Int64
 
-	// Blocks queried.
-	// Entry 0 is the "0-13h ago" block for queries to ingesters.
-	// Entry 1 is the "12-24h ago" block.
-	// Subsequent entries are for following 24h periods (24-48h, 48-72h, ...)
+	// layout describes the variable-width buckets that blockRangesQueried is indexed by: hourly
+	// while a select falls within the ingester's retention window, then progressively wider
+	// store-gateway blocks as it ages. Shared across every queryCounters in a statistics, so it's
+	// never mutated after construction.
+	layout *blockLayout
+
 	blockRangesQueried []atomic.Int64
 }
 
-func newStatistics() *statistics {
-	return &statistics{
-		blockRangesQueried: make([]atomic.Int64, 396), // 13 months (395 days), but first day is split into 0-13h and 12-24h blocks.
+func newQueryCounters(layout *blockLayout) *queryCounters {
+	return &queryCounters{
+		layout:             layout,
+		blockRangesQueried: make([]atomic.Int64, layout.numBuckets()),
 	}
 }
 
-func (s *statistics) IncrementBlockRanges(from, to time.Duration) {
+func (c *queryCounters) IncrementBlockRanges(from, to time.Duration) {
 	if from > to {
 		panic(fmt.Sprintf("from time (%v) after to time (%v)", from, to))
 	}
 
-	s.selectCount.Add(1)
+	c.selectCount.Add(1)
 
 	currentBlock := max(0, from)
 
 	for currentBlock < to {
-		i := currentBlock / time.Hour
-
-		if int(i) >= len(s.blockRangesQueried) {
-			// Reached the end of 365 day range. We're done.
+		i := c.layout.bucketIndex(currentBlock)
+		if i < 0 {
+			// Reached the end of the configured retention. We're done.
 			return
 		}
 
-		s.blockRangesQueried[i].Add(1)
+		c.blockRangesQueried[i].Add(1)
+
+		_, bucketEnd := c.layout.bucketRange(i)
+		currentBlock = bucketEnd
+	}
+}
 
-		if currentBlock%(time.Hour) == 0 {
-			// Already on a block boundary, advance to next block.
-			currentBlock += time.Hour
-		} else {
-			// Not at a block boundary, advance to beginning of next block.
-			currentBlock += time.Hour - (currentBlock % time.Hour)
+func (c *queryCounters) ForBlockRanges(f func(start, end time.Duration, count int64) error) error {
+	for i := range c.blockRangesQueried {
+		start, end := c.layout.bucketRange(i)
+
+		if err := f(start, end, c.blockRangesQueried[i].Load()); err != nil {
+			return err
 		}
 	}
+
+	return nil
+}
+
+type statistics struct {
+	*queryCounters
+
+	// Annotations (warnings/infos) produced by the engine while executing a query, keyed by
+	// the normalized form of the query that produced them and then by the annotation text.
+	annotationsByQueryMu sync.Mutex
+	annotationsByQuery   map[string]map[string]int64
+
+	// Query and select counts bucketed by time.
+	rates *rateSeries
+
+	// Query and select counts broken down by tenant, for log lines that identify one.
+	tenantsMu sync.RWMutex
+	tenants   map[string]*queryCounters
+
+	// Query counts broken down by parser.QueryKind, covering every log line analysed, not just the
+	// instant/range queries that are executed against the PromQL engine.
+	kindCounts [parser.NumQueryKinds]atomic.Int64
+}
+
+func newStatistics(layout *blockLayout) *statistics {
+	return &statistics{
+		queryCounters:      newQueryCounters(layout),
+		annotationsByQuery: make(map[string]map[string]int64),
+		rates:              newRateSeries(*rateResolution, *maxRateBuckets),
+		tenants:            make(map[string]*queryCounters),
+	}
 }
 
-func (s *statistics) ForBlockRanges(f func(start time.Duration, count int64) error) error {
-	for i := range s.blockRangesQueried {
-		start := time.Duration(i) * time.Hour
+// recordKind increments the count for k.
+func (s *statistics) recordKind(k parser.QueryKind) {
+	s.kindCounts[k].Add(1)
+}
 
-		if err := f(start, s.blockRangesQueried[i].Load()); err != nil {
+// ForKindCounts calls f once for each parser.QueryKind, along with how many log lines of that kind
+// have been analysed.
+func (s *statistics) ForKindCounts(f func(kind parser.QueryKind, count int64) error) error {
+	for k := parser.QueryKind(0); k < parser.NumQueryKinds; k++ {
+		if err := f(k, s.kindCounts[k].Load()); err != nil {
 			return err
 		}
 	}
@@ -137,7 +394,65 @@ func (s *statistics) ForBlockRanges(f func(start time.Duration, count int64) err
 	return nil
 }
 
-func analyseFile(path string, stats *statistics) error {
+// forTenant returns the counters for tenant, creating them if this is the first time it's been
+// seen.
+func (s *statistics) forTenant(tenant string) *queryCounters {
+	s.tenantsMu.RLock()
+	c, ok := s.tenants[tenant]
+	s.tenantsMu.RUnlock()
+
+	if ok {
+		return c
+	}
+
+	s.tenantsMu.Lock()
+	defer s.tenantsMu.Unlock()
+
+	if c, ok := s.tenants[tenant]; ok {
+		return c
+	}
+
+	c = newQueryCounters(s.layout)
+	s.tenants[tenant] = c
+
+	return c
+}
+
+// RecordAnnotation records that annotation fired once for the normalized form of query.
+func (s *statistics) RecordAnnotation(query, annotation string) {
+	s.annotationsByQueryMu.Lock()
+	defer s.annotationsByQueryMu.Unlock()
+
+	if _, ok := s.annotationsByQuery[query]; !ok {
+		s.annotationsByQuery[query] = map[string]int64{}
+	}
+
+	s.annotationsByQuery[query][annotation]++
+}
+
+// ForAnnotations calls f once for each (query, annotation) pair that has been recorded, along with
+// the number of times it fired.
+func (s *statistics) ForAnnotations(f func(query, annotation string, count int64) error) error {
+	s.annotationsByQueryMu.Lock()
+	defer s.annotationsByQueryMu.Unlock()
+
+	for query, annotations := range s.annotationsByQuery {
+		for annotation, count := range annotations {
+			if err := f(query, annotation, count); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// analyseFile reads path one line at a time and fans parsed log lines out to a pool of
+// concurrency workers, each calling analyseLogLine. Lines are parsed sequentially as they're read,
+// since that's cheap relative to the PromQL parse/plan/exec cost that analyseLogLine incurs, and
+// pushed onto a bounded channel so a slow worker pool can't let an unbounded number of parsed lines
+// pile up in memory.
+func analyseFile(path string, stats *statistics, concurrency int, lineFilter filter.Filter, opts ingestOptions) error {
 	f, err := os.Open(path)
 
 	if err != nil {
@@ -146,6 +461,107 @@ func analyseFile(path string, stats *statistics) error {
 
 	defer f.Close()
 
+	lines := make(chan parser.LogLine, concurrency)
+	stop := make(chan struct{})
+
+	var workerErr error
+	var workerErrOnce sync.Once
+	var wg sync.WaitGroup
+
+	wg.Add(concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for l := range lines {
+				if err := analyseLogLine(l, stats); err != nil {
+					workerErrOnce.Do(func() {
+						workerErr = err
+						close(stop)
+					})
+
+					return
+				}
+			}
+		}()
+	}
+
+	var decoder parser.Decoder
+
+	readErr := readLines(f, func(line string) error {
+		if decoder == nil {
+			decoder, err = resolveDecoder(opts.format, line)
+			if err != nil {
+				return err
+			}
+		}
+
+		parsed, err := decoder.Decode([]byte(line))
+		if err != nil {
+			if errors.Is(err, parser.ErrSkipLine) {
+				return nil
+			}
+
+			return fmt.Errorf("parsing log line '%v' failed: %w", line, err)
+		}
+
+		parsed, keep := normalizeSentinelTimes(parsed, opts.sentinelMode, opts.sentinelBounds)
+		if !keep {
+			return nil
+		}
+
+		if !lineFilter.Matches(parsed) {
+			return nil
+		}
+
+		select {
+		case lines <- parsed:
+			return nil
+		case <-stop:
+			return errStoppedEarly
+		}
+	})
+
+	close(lines)
+	wg.Wait()
+
+	if workerErr != nil {
+		return workerErr
+	}
+
+	if readErr != nil && readErr != errStoppedEarly {
+		return readErr
+	}
+
+	return nil
+}
+
+// resolveDecoder returns the parser.Decoder that format names, or, if format is empty, sniffs it
+// from firstLine. It's shared by analyseFile, replayFile and analyzeFile, since each needs to pick
+// a decoder once per file before decoding the rest of its lines.
+func resolveDecoder(format parser.Format, firstLine string) (parser.Decoder, error) {
+	if format != "" {
+		return parser.New(format)
+	}
+
+	sniffed, err := parser.Sniff([]byte(firstLine))
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Detected log format", "format", sniffed)
+
+	return parser.New(sniffed)
+}
+
+// errStoppedEarly is a sentinel used internally by analyseFile to unwind readLines once a worker
+// has already failed; it is never returned to callers.
+var errStoppedEarly = errors.New("stopped early because a worker failed")
+
+// readLines reads from f one (potentially very long) line at a time, calling onLine for each one,
+// until EOF or onLine returns an error.
+func readLines(f io.Reader, onLine func(line string) error) error {
 	r := bufio.NewReader(f)
 
 	for {
@@ -168,26 +584,12 @@ func analyseFile(path string, stats *statistics) error {
 			}
 		}
 
-		if err := parseAndAnalyseLogLine(l, stats); err != nil {
+		if err := onLine(l); err != nil {
 			return err
 		}
 	}
 }
 
-func parseAndAnalyseLogLine(line string, stats *statistics) error {
-	logLine, skip, err := parseLogLine(line)
-
-	if skip == true {
-		return nil
-	}
-
-	if err != nil {
-		return fmt.Errorf("parsing log line '%v' failed: %w", line, err)
-	}
-
-	return analyseLogLine(logLine, stats)
-}
-
 var engine = promql.NewEngine(promql.EngineOpts{
 	Logger:        log.NewNopLogger(),
 	LookbackDelta: 5 * time.Minute, // Default value.
@@ -204,21 +606,33 @@ var engine = promql.NewEngine(promql.EngineOpts{
 
 var queryOpts = promql.NewPrometheusQueryOpts(false, 0)
 
-func analyseLogLine(logLine logLine, stats *statistics) error {
+func analyseLogLine(line parser.LogLine, stats *statistics) error {
 	stats.queryCount.Add(1)
+	stats.recordKind(line.Kind)
+
+	if line.Tenant != "" {
+		stats.forTenant(line.Tenant).queryCount.Add(1)
+	}
+
+	if line.Kind != parser.QueryKindInstant && line.Kind != parser.QueryKindRange {
+		// Only instant and range queries can be executed against the PromQL engine; the other
+		// kinds (series/labels/label_values/exemplars/remote_read) are just counted above.
+		return nil
+	}
 
 	queryable := &queryRangeCollectingQueryable{
 		stats:          stats,
-		queryTimestamp: logLine.timestamp,
+		queryTimestamp: line.Timestamp,
+		tenant:         line.Tenant,
 	}
 
 	var q promql.Query
 	var err error
 
-	if logLine.isRangeQuery {
-		q, err = engine.NewRangeQuery(context.Background(), queryable, queryOpts, logLine.query, logLine.queryStartTime, logLine.queryEndTime, logLine.queryStep)
+	if line.Kind == parser.QueryKindRange {
+		q, err = engine.NewRangeQuery(context.Background(), queryable, queryOpts, line.Query, line.QueryStartTime, line.QueryEndTime, line.QueryStep)
 	} else {
-		q, err = engine.NewInstantQuery(context.Background(), queryable, queryOpts, logLine.query, logLine.queryTime)
+		q, err = engine.NewInstantQuery(context.Background(), queryable, queryOpts, line.Query, line.QueryTime)
 	}
 
 	if err != nil {
@@ -232,6 +646,19 @@ func analyseLogLine(logLine logLine, stats *statistics) error {
 		return fmt.Errorf("query execution failed: %w", result.Err)
 	}
 
+	if len(result.Warnings) > 0 {
+		normalized, err := normalizeQuery(line.Query)
+		if err != nil {
+			return fmt.Errorf("could not normalize query for annotation reporting: %w", err)
+		}
+
+		for _, w := range result.Warnings {
+			stats.RecordAnnotation(normalized, w.Error())
+		}
+	}
+
+	stats.rates.Record(line.Timestamp, queryable.selectCount.Load())
+
 	return nil
 }
 
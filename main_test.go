@@ -1,13 +1,14 @@
 package main
 
 import (
+	"github.com/charleskorn/query-log-analysis/parser"
 	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
 )
 
 func TestStatistics(t *testing.T) {
-	s := newStatistics()
+	s := newStatistics(newBlockLayout(defaultBlockLayoutConfig()))
 
 	// Query range in the future
 	s.IncrementBlockRanges(-1*time.Hour, -10*time.Minute)
@@ -47,126 +48,127 @@ func TestQueryAnalysis(t *testing.T) {
 	baseTimestamp := time.Date(2023, 11, 13, 9, 20, 0, 0, time.UTC)
 
 	testCases := map[string]struct {
-		input logLine
+		input parser.LogLine
 
 		expectedSelectCount        int64
 		expectedBlockRangesQueried map[time.Duration]int64
 	}{
 		"single select, range query touching single block": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "metric{}",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "metric{}",
 
-				isRangeQuery:   true,
-				queryStartTime: baseTimestamp.Add(-47 * time.Hour),
-				queryEndTime:   baseTimestamp.Add(-46 * time.Hour),
-				queryStep:      30 * time.Second,
+				Kind:           parser.QueryKindRange,
+				QueryStartTime: baseTimestamp.Add(-47 * time.Hour),
+				QueryEndTime:   baseTimestamp.Add(-46 * time.Hour),
+				QueryStep:      30 * time.Second,
 			},
 			expectedSelectCount: 1,
 			expectedBlockRangesQueried: map[time.Duration]int64{
-				46 * time.Hour: 1,
-				47 * time.Hour: 1, // For lookback window
+				// 46h and 47h ago both fall within the default layout's 24h recent compaction
+				// block (27h-51h ago), so they're attributed to a single bucket.
+				27 * time.Hour: 1,
 			},
 		},
 		"single select, range query touching multiple blocks": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "metric{}",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "metric{}",
 
-				isRangeQuery:   true,
-				queryStartTime: baseTimestamp.Add(-29 * time.Hour),
-				queryEndTime:   baseTimestamp.Add(-27 * time.Hour),
-				queryStep:      30 * time.Second,
+				Kind:           parser.QueryKindRange,
+				QueryStartTime: baseTimestamp.Add(-16 * time.Hour),
+				QueryEndTime:   baseTimestamp.Add(-14 * time.Hour),
+				QueryStep:      30 * time.Second,
 			},
 			expectedSelectCount: 1,
 			expectedBlockRangesQueried: map[time.Duration]int64{
-				27 * time.Hour: 1,
-				28 * time.Hour: 1,
-				29 * time.Hour: 1,
+				// This range crosses the boundary between the default layout's 2h recent
+				// compaction block (13h-15h ago) and its 12h recent compaction block (15h-27h
+				// ago).
+				13 * time.Hour: 1,
+				15 * time.Hour: 1,
 			},
 		},
 		"single select, range query with range selector": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "rate(metric{}[2h])",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "rate(metric{}[2h])",
 
-				isRangeQuery:   true,
-				queryStartTime: baseTimestamp.Add(-48 * time.Hour),
-				queryEndTime:   baseTimestamp.Add(-47 * time.Hour),
-				queryStep:      30 * time.Second,
+				Kind:           parser.QueryKindRange,
+				QueryStartTime: baseTimestamp.Add(-48 * time.Hour),
+				QueryEndTime:   baseTimestamp.Add(-47 * time.Hour),
+				QueryStep:      30 * time.Second,
 			},
 			expectedSelectCount: 1,
 			expectedBlockRangesQueried: map[time.Duration]int64{
-				47 * time.Hour: 1,
-				48 * time.Hour: 1,
-				49 * time.Hour: 1, // For lookback window.
+				// 47h-50h ago (the 2h range selector reaches back from the 48h-ago start) all
+				// fall within the default layout's 24h recent compaction block (27h-51h ago).
+				27 * time.Hour: 1,
 			},
 		},
 		"single select, instant query": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "metric{}",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "metric{}",
 
-				isRangeQuery: false,
-				queryTime:    baseTimestamp.Add(-47 * time.Hour),
+				Kind:      parser.QueryKindInstant,
+				QueryTime: baseTimestamp.Add(-47 * time.Hour),
 			},
 			expectedSelectCount: 1,
 			expectedBlockRangesQueried: map[time.Duration]int64{
-				47 * time.Hour: 1,
+				27 * time.Hour: 1,
 			},
 		},
 		"single select, instant query with range selector": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "rate(metric{}[2h])",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "rate(metric{}[2h])",
 
-				isRangeQuery: false,
-				queryTime:    baseTimestamp.Add(-47 * time.Hour),
+				Kind:      parser.QueryKindInstant,
+				QueryTime: baseTimestamp.Add(-47 * time.Hour),
 			},
 			expectedSelectCount: 1,
 			expectedBlockRangesQueried: map[time.Duration]int64{
-				47 * time.Hour: 1,
-				48 * time.Hour: 1,
+				27 * time.Hour: 1,
 			},
 		},
 		"multiple selects": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "metric_A{} / metric_B{}",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "metric_A{} / metric_B{}",
 
-				isRangeQuery:   true,
-				queryStartTime: baseTimestamp.Add(-47 * time.Hour),
-				queryEndTime:   baseTimestamp.Add(-46 * time.Hour),
-				queryStep:      30 * time.Second,
+				Kind:           parser.QueryKindRange,
+				QueryStartTime: baseTimestamp.Add(-47 * time.Hour),
+				QueryEndTime:   baseTimestamp.Add(-46 * time.Hour),
+				QueryStep:      30 * time.Second,
 			},
 			expectedSelectCount: 2,
 			expectedBlockRangesQueried: map[time.Duration]int64{
-				46 * time.Hour: 2,
-				47 * time.Hour: 2, // For lookback window.
+				27 * time.Hour: 2,
 			},
 		},
 		"no selects": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "vector(1)",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "vector(1)",
 
-				isRangeQuery:   true,
-				queryStartTime: baseTimestamp.Add(-48 * time.Hour),
-				queryEndTime:   baseTimestamp.Add(-47 * time.Hour),
-				queryStep:      30 * time.Second,
+				Kind:           parser.QueryKindRange,
+				QueryStartTime: baseTimestamp.Add(-48 * time.Hour),
+				QueryEndTime:   baseTimestamp.Add(-47 * time.Hour),
+				QueryStep:      30 * time.Second,
 			},
 			expectedSelectCount:        0,
 			expectedBlockRangesQueried: map[time.Duration]int64{},
 		},
 		"single select, for ingester query time range": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "metric{}",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "metric{}",
 
-				isRangeQuery:   true,
-				queryStartTime: baseTimestamp.Add(-3 * time.Hour),
-				queryEndTime:   baseTimestamp.Add(-1 * time.Hour),
-				queryStep:      30 * time.Second,
+				Kind:           parser.QueryKindRange,
+				QueryStartTime: baseTimestamp.Add(-3 * time.Hour),
+				QueryEndTime:   baseTimestamp.Add(-1 * time.Hour),
+				QueryStep:      30 * time.Second,
 			},
 			expectedSelectCount: 1,
 			expectedBlockRangesQueried: map[time.Duration]int64{
@@ -176,17 +178,19 @@ func TestQueryAnalysis(t *testing.T) {
 			},
 		},
 		"single select, for ingester and store-gateway query time range": {
-			input: logLine{
-				timestamp: baseTimestamp,
-				query:     "metric{}",
+			input: parser.LogLine{
+				Timestamp: baseTimestamp,
+				Query:     "metric{}",
 
-				isRangeQuery:   true,
-				queryStartTime: baseTimestamp.Add(-15 * time.Hour),
-				queryEndTime:   baseTimestamp.Add(-1 * time.Hour),
-				queryStep:      30 * time.Second,
+				Kind:           parser.QueryKindRange,
+				QueryStartTime: baseTimestamp.Add(-20 * time.Hour),
+				QueryEndTime:   baseTimestamp.Add(-1 * time.Hour),
+				QueryStep:      30 * time.Second,
 			},
 			expectedSelectCount: 1,
 			expectedBlockRangesQueried: map[time.Duration]int64{
+				// Ingester tier (hourly buckets up to 13h ago), then the 2h recent compaction
+				// block (13h-15h ago), then the 12h recent compaction block (15h-27h ago).
 				1 * time.Hour:  1,
 				2 * time.Hour:  1,
 				3 * time.Hour:  1,
@@ -200,7 +204,6 @@ func TestQueryAnalysis(t *testing.T) {
 				11 * time.Hour: 1,
 				12 * time.Hour: 1,
 				13 * time.Hour: 1,
-				14 * time.Hour: 1,
 				15 * time.Hour: 1,
 			},
 		},
@@ -208,7 +211,7 @@ func TestQueryAnalysis(t *testing.T) {
 
 	for name, testCase := range testCases {
 		t.Run(name, func(t *testing.T) {
-			stats := newStatistics()
+			stats := newStatistics(newBlockLayout(defaultBlockLayoutConfig()))
 
 			require.NoError(t, analyseLogLine(testCase.input, stats))
 
@@ -219,10 +222,86 @@ func TestQueryAnalysis(t *testing.T) {
 	}
 }
 
+func TestStatisticsAnnotations(t *testing.T) {
+	s := newStatistics(newBlockLayout(defaultBlockLayoutConfig()))
+
+	require.NoError(t, s.ForAnnotations(func(query, annotation string, count int64) error {
+		t.Fatalf("unexpected annotation %v/%v", query, annotation)
+		return nil
+	}))
+
+	s.RecordAnnotation("metric{}", "PromQL warning: found duplicate series")
+	s.RecordAnnotation("metric{}", "PromQL warning: found duplicate series")
+	s.RecordAnnotation("rate(metric{}[1m])", "PromQL info: metric might not be a counter")
+
+	actual := map[string]map[string]int64{}
+
+	require.NoError(t, s.ForAnnotations(func(query, annotation string, count int64) error {
+		if _, ok := actual[query]; !ok {
+			actual[query] = map[string]int64{}
+		}
+
+		actual[query][annotation] = count
+
+		return nil
+	}))
+
+	require.Equal(t, map[string]map[string]int64{
+		"metric{}":           {"PromQL warning: found duplicate series": 2},
+		"rate(metric{}[1m])": {"PromQL info: metric might not be a counter": 1},
+	}, actual)
+}
+
+func TestStatisticsPerTenant(t *testing.T) {
+	baseTimestamp := time.Date(2023, 11, 13, 9, 20, 0, 0, time.UTC)
+
+	stats := newStatistics(newBlockLayout(defaultBlockLayoutConfig()))
+
+	require.NoError(t, analyseLogLine(parser.LogLine{
+		Timestamp: baseTimestamp,
+		Query:     "metric{}",
+		Tenant:    "tenant-a",
+
+		Kind:           parser.QueryKindRange,
+		QueryStartTime: baseTimestamp.Add(-2 * time.Hour),
+		QueryEndTime:   baseTimestamp.Add(-1 * time.Hour),
+		QueryStep:      30 * time.Second,
+	}, stats))
+
+	require.NoError(t, analyseLogLine(parser.LogLine{
+		Timestamp: baseTimestamp,
+		Query:     "metric{}",
+		Tenant:    "tenant-b",
+
+		Kind:      parser.QueryKindInstant,
+		QueryTime: baseTimestamp.Add(-1 * time.Hour),
+	}, stats))
+
+	// A query with no tenant shouldn't show up in the per-tenant breakdown.
+	require.NoError(t, analyseLogLine(parser.LogLine{
+		Timestamp: baseTimestamp,
+		Query:     "metric{}",
+		Kind:      parser.QueryKindInstant,
+		QueryTime: baseTimestamp.Add(-1 * time.Hour),
+	}, stats))
+
+	require.Equal(t, int64(3), stats.queryCount.Load())
+
+	tenantA := stats.forTenant("tenant-a")
+	require.Equal(t, int64(1), tenantA.queryCount.Load())
+	require.Equal(t, int64(1), tenantA.selectCount.Load())
+
+	tenantB := stats.forTenant("tenant-b")
+	require.Equal(t, int64(1), tenantB.queryCount.Load())
+	require.Equal(t, int64(1), tenantB.selectCount.Load())
+
+	require.Len(t, stats.tenants, 2)
+}
+
 func requireBlockRangesQueried(t *testing.T, stats *statistics, expected map[time.Duration]int64) {
 	actual := map[time.Duration]int64{}
 
-	_ = stats.ForBlockRanges(func(start time.Duration, actualCount int64) error {
+	_ = stats.ForBlockRanges(func(start, end time.Duration, actualCount int64) error {
 		if actualCount != 0 {
 			actual[start] = actualCount
 		}
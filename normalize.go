@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// normalizeQuery parses query and replaces the parts of it that tend to vary
+// between otherwise-identical queries (label matchers, literal values,
+// aggregation/binary-op grouping labels) with placeholders, so that queries
+// that share the same shape are grouped together.
+func normalizeQuery(query string) (string, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", fmt.Errorf("could not parse query '%s': %w", query, err)
+	}
+
+	if err := normalizeExpr(expr); err != nil {
+		return "", fmt.Errorf("could not normalize query '%s': %w", query, err)
+	}
+
+	return expr.String(), nil
+}
+
+func normalizeExpr(expr parser.Expr) error {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+
+	case *parser.AggregateExpr:
+		if err := normalizeExpr(e.Expr); err != nil {
+			return err
+		}
+
+		if err := normalizeExpr(e.Param); err != nil {
+			return err
+		}
+
+		if len(e.Grouping) > 0 {
+			e.Grouping = []string{"labels"}
+		}
+
+		return nil
+
+	case *parser.BinaryExpr:
+		if err := normalizeExpr(e.LHS); err != nil {
+			return err
+		}
+
+		if err := normalizeExpr(e.RHS); err != nil {
+			return err
+		}
+
+		if e.VectorMatching != nil {
+			if len(e.VectorMatching.MatchingLabels) > 0 {
+				e.VectorMatching.MatchingLabels = []string{"labels"}
+			}
+
+			if len(e.VectorMatching.Include) > 0 {
+				e.VectorMatching.Include = []string{"labels"}
+			}
+		}
+
+		return nil
+
+	case *parser.Call:
+		for _, arg := range e.Args {
+			if err := normalizeExpr(arg); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case *parser.MatrixSelector:
+		e.Range = time.Minute
+		return normalizeExpr(e.VectorSelector)
+
+	case *parser.SubqueryExpr:
+		e.Step = time.Minute
+		e.Range = time.Hour
+		return normalizeExpr(e.Expr)
+
+	case *parser.NumberLiteral:
+		e.Val = 0
+		return nil
+
+	case *parser.ParenExpr:
+		return normalizeExpr(e.Expr)
+
+	case *parser.StringLiteral:
+		e.Val = "<string>"
+		return nil
+
+	case *parser.UnaryExpr:
+		return normalizeExpr(e.Expr)
+
+	case *parser.StepInvariantExpr:
+		return normalizeExpr(e.Expr)
+
+	case *parser.VectorSelector:
+		e.Name = "metric"
+		e.LabelMatchers = nil
+		return nil
+
+	default:
+		return fmt.Errorf("unknown expression type %T", expr)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected string
+	}{
+		"aggregate with grouping": {
+			input:    `sum by (instance) (rate(metric_a{job="x"}[5m]))`,
+			expected: `sum by (labels) (rate(metric[1m]))`,
+		},
+		"aggregate with different grouping produces the same shape": {
+			input:    `sum by (pod) (rate(metric_a{job="x"}[5m]))`,
+			expected: `sum by (labels) (rate(metric[1m]))`,
+		},
+		"binary expression with vector matching": {
+			input:    `metric_a{job="x"} / on (instance) group_left (pod) metric_b{job="y"}`,
+			expected: `metric / on (labels) group_left (labels) metric`,
+		},
+		"subquery": {
+			input:    `rate(metric_a{job="x"}[1h:30s])`,
+			expected: `rate(metric[1h:1m])`,
+		},
+		"nested call": {
+			input:    `topk(5, sum(rate(metric_a{job="x"}[5m])))`,
+			expected: `topk(0, sum(rate(metric[1m])))`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := normalizeQuery(tc.input)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logfmt/logfmt"
+)
+
+// LokiDecoder decodes Loki query-frontend access log lines: one JSON object per line, with a
+// "line" field holding the actual logfmt-encoded request log, in the same transport shape as
+// Prometheus's but with Loki's own query parameter names (query, start, end, step, direction,
+// limit) in place of Prometheus's param_* names.
+type LokiDecoder struct{}
+
+func (LokiDecoder) Decode(line []byte) (LogLine, error) {
+	jsonLine := struct {
+		Line string `json:"line"`
+	}{}
+
+	if err := json.Unmarshal(line, &jsonLine); err != nil {
+		return LogLine{}, err
+	}
+
+	d := logfmt.NewDecoder(strings.NewReader(jsonLine.Line))
+	parsed := LogLine{}
+
+	var sawPath bool
+
+	for d.ScanRecord() {
+		for d.ScanKeyval() {
+			value := string(d.Value())
+
+			switch string(d.Key()) {
+			case "ts":
+				ts, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid log timestamp '%v': %w", value, err)
+				}
+				parsed.Timestamp = ts
+
+			case "org_id":
+				parsed.Tenant = value
+
+			case "path":
+				kind, recognised := classifyLokiPath(value)
+				if !recognised {
+					return LogLine{}, ErrSkipLine
+				}
+				parsed.Kind = kind
+				sawPath = true
+
+			case "query":
+				parsed.Query = value
+
+			case "start":
+				ts, err := ParseTime(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid start time '%v': %w", value, err)
+				}
+				parsed.QueryStartTime = ts
+
+			case "end":
+				ts, err := ParseTime(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid end time '%v': %w", value, err)
+				}
+				parsed.QueryEndTime = ts
+
+			case "time":
+				ts, err := ParseTime(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid query time '%v': %w", value, err)
+				}
+				parsed.QueryTime = ts
+
+			case "step":
+				step, err := ParseDuration(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid step '%v': %w", value, err)
+				}
+				parsed.QueryStep = step
+
+			case "direction":
+				parsed.Direction = value
+
+			case "limit":
+				limit, err := strconv.Atoi(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid limit '%v': %w", value, err)
+				}
+				parsed.Limit = limit
+			}
+		}
+	}
+
+	if !sawPath {
+		// No recognised "path" field at all, eg. this decoder was handed a non-Loki line while
+		// sniffing the log format. There's nothing here for this decoder to analyse.
+		return LogLine{}, ErrSkipLine
+	}
+
+	if parsed.Timestamp.IsZero() {
+		return LogLine{}, errors.New("no timestamp")
+	}
+
+	if err := parsed.validate(); err != nil {
+		return LogLine{}, err
+	}
+
+	return parsed, d.Err()
+}
+
+// classifyLokiPath determines the QueryKind represented by the "path" field of a Loki
+// query-frontend log line. Only the two PromQL-metric-query endpoints are recognised; every other
+// Loki endpoint (push, log queries, tailing, ...) is reported as unrecognised so the caller can
+// skip it.
+func classifyLokiPath(path string) (kind QueryKind, recognised bool) {
+	switch path {
+	case "/loki/api/v1/query_range":
+		return QueryKindRange, true
+	case "/loki/api/v1/query":
+		return QueryKindInstant, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,145 @@
+// Package parser decodes individual lines from a query-frontend access log into a LogLine,
+// independent of which upstream project (Prometheus/Mimir, Loki, ...) produced the log.
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LogLine is a single parsed entry from a query log, translated into a common shape regardless of
+// which Decoder produced it.
+type LogLine struct {
+	Timestamp time.Time
+	Query     string
+
+	// Tenant is the Mimir/Cortex/Loki tenant (org_id / X-Scope-OrgID) that issued the query, or ""
+	// if the log line doesn't identify one (eg. a single-tenant deployment).
+	Tenant string
+
+	// User is the authenticated user that issued the query, or "" if the log line doesn't
+	// identify one.
+	User string
+
+	// Kind identifies which query API endpoint this line represents.
+	Kind QueryKind
+
+	// Instant and range query fields
+	QueryTime time.Time
+
+	// Range query fields
+	QueryStartTime time.Time
+	QueryEndTime   time.Time
+	QueryStep      time.Duration
+
+	// Interval is the Loki-style step sampling interval (param_interval), used by Prometheus's
+	// /series and /labels requests.
+	Interval time.Duration
+
+	// Timeout is the server-side evaluation timeout requested for the query (param_timeout).
+	Timeout time.Duration
+
+	// LookbackDelta overrides the engine's default lookback delta for this query
+	// (param_lookback_delta).
+	LookbackDelta time.Duration
+
+	// Stats is the verbosity of execution statistics requested (param_stats), eg. "all".
+	Stats string
+
+	// Matchers holds the repeated match[]/param_match[] series-selector list used by /series and
+	// /labels requests.
+	Matchers []string
+
+	// LabelName is the label name requested by a /label/<name>/values request, and is empty for
+	// every other kind.
+	LabelName string
+
+	// Direction is Loki's log-direction parameter ("forward" or "backward") for a query_range
+	// request, and is empty for every other kind.
+	Direction string
+
+	// Limit is Loki's line-count limit parameter for a query_range/query request, and is zero if
+	// the log line didn't carry one.
+	Limit int
+}
+
+// ErrSkipLine is returned by a Decoder when a line is validly formatted but doesn't represent a
+// query worth analysing (eg. a request to an endpoint the decoder doesn't track); callers should
+// silently move on to the next line rather than treating it as a parse failure.
+var ErrSkipLine = errors.New("not a query log line")
+
+// Decoder turns a single raw log line into a LogLine.
+type Decoder interface {
+	Decode(line []byte) (LogLine, error)
+}
+
+// validate checks that the fields required for l's Kind are present, since each query API
+// endpoint accepts (and requires) a different combination of parameters. It's shared by every
+// Decoder, since the requirements follow from Kind alone, not from which upstream project produced
+// the line.
+func (l LogLine) validate() error {
+	switch l.Kind {
+	case QueryKindInstant:
+		if l.Query == "" {
+			return errors.New("no query for instant query")
+		}
+
+		if l.QueryTime.IsZero() {
+			return errors.New("no query time for instant query")
+		}
+
+	case QueryKindRange:
+		if l.Query == "" {
+			return errors.New("no query for range query")
+		}
+
+		if l.QueryStartTime.IsZero() {
+			return errors.New("no query start time for range query")
+		}
+
+		if l.QueryEndTime.IsZero() {
+			return errors.New("no query end time for range query")
+		}
+
+		if l.QueryStep == 0 {
+			return errors.New("no step for range query")
+		}
+
+	case QueryKindSeries:
+		if len(l.Matchers) == 0 {
+			return errors.New("no match[] selectors for series request")
+		}
+
+	case QueryKindLabels:
+		// No parameters are strictly required: an unqualified /labels request matches every
+		// series.
+
+	case QueryKindLabelValues:
+		if l.LabelName == "" {
+			return errors.New("no label name for label values request")
+		}
+
+	case QueryKindExemplars:
+		if l.Query == "" {
+			return errors.New("no query for exemplars request")
+		}
+
+		if l.QueryStartTime.IsZero() {
+			return errors.New("no query start time for exemplars request")
+		}
+
+		if l.QueryEndTime.IsZero() {
+			return errors.New("no query end time for exemplars request")
+		}
+
+	case QueryKindRemoteRead:
+		// The request body (not captured in the query log) carries the actual matchers and time
+		// range, so there's nothing further to validate here.
+
+	default:
+		return fmt.Errorf("unknown query kind %v", l.Kind)
+	}
+
+	return nil
+}
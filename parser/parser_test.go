@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusDecoderInstantQuery(t *testing.T) {
+	line := `{"line": "ts=2023-11-13T09:20:00.000000000Z path=/prometheus/api/v1/query org_id=tenant-a param_query=up param_time=1699867200"}`
+
+	parsed, err := PrometheusDecoder{}.Decode([]byte(line))
+	require.NoError(t, err)
+
+	require.Equal(t, QueryKindInstant, parsed.Kind)
+	require.Equal(t, "up", parsed.Query)
+	require.Equal(t, "tenant-a", parsed.Tenant)
+	require.True(t, parsed.QueryTime.Equal(time.Unix(1699867200, 0).UTC()))
+}
+
+func TestPrometheusDecoderSkipsUnrecognisedPath(t *testing.T) {
+	line := `{"line": "ts=2023-11-13T09:20:00.000000000Z path=/ready"}`
+
+	_, err := PrometheusDecoder{}.Decode([]byte(line))
+	require.ErrorIs(t, err, ErrSkipLine)
+}
+
+func TestLokiDecoderRangeQuery(t *testing.T) {
+	line := `{"line": "ts=2023-11-13T09:20:00.000000000Z path=/loki/api/v1/query_range org_id=tenant-a query=up start=1699860000 end=1699863600 step=15s direction=backward limit=100"}`
+
+	parsed, err := LokiDecoder{}.Decode([]byte(line))
+	require.NoError(t, err)
+
+	require.Equal(t, QueryKindRange, parsed.Kind)
+	require.Equal(t, "up", parsed.Query)
+	require.Equal(t, "backward", parsed.Direction)
+	require.Equal(t, 100, parsed.Limit)
+	require.Equal(t, 15*time.Second, parsed.QueryStep)
+}
+
+func TestLokiDecoderSkipsUnrecognisedPath(t *testing.T) {
+	line := `{"line": "ts=2023-11-13T09:20:00.000000000Z path=/loki/api/v1/push"}`
+
+	_, err := LokiDecoder{}.Decode([]byte(line))
+	require.ErrorIs(t, err, ErrSkipLine)
+}
+
+func TestSniff(t *testing.T) {
+	prometheusLine := `{"line": "ts=2023-11-13T09:20:00.000000000Z path=/prometheus/api/v1/query param_query=up param_time=1699867200"}`
+	lokiLine := `{"line": "ts=2023-11-13T09:20:00.000000000Z path=/loki/api/v1/query_range query=up start=1699860000 end=1699863600 step=15s"}`
+
+	format, err := Sniff([]byte(prometheusLine))
+	require.NoError(t, err)
+	require.Equal(t, FormatPrometheus, format)
+
+	format, err = Sniff([]byte(lokiLine))
+	require.NoError(t, err)
+	require.Equal(t, FormatLoki, format)
+
+	_, err = Sniff([]byte(`not json`))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrSkipLine))
+}
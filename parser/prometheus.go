@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logfmt/logfmt"
+)
+
+// PrometheusDecoder decodes Mimir/Cortex/Prometheus query-frontend access log lines: one JSON
+// object per line, with a "line" field holding the actual logfmt-encoded request log.
+type PrometheusDecoder struct{}
+
+func (PrometheusDecoder) Decode(line []byte) (LogLine, error) {
+	jsonLine := struct {
+		Line string `json:"line"`
+	}{}
+
+	if err := json.Unmarshal(line, &jsonLine); err != nil {
+		return LogLine{}, err
+	}
+
+	d := logfmt.NewDecoder(strings.NewReader(jsonLine.Line))
+	parsed := LogLine{}
+
+	for d.ScanRecord() {
+		for d.ScanKeyval() {
+			value := string(d.Value())
+
+			switch string(d.Key()) {
+			case "ts":
+				ts, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid log timestamp '%v': %w", value, err)
+				}
+				parsed.Timestamp = ts
+
+			case "param_query":
+				parsed.Query = value
+
+			case "org_id":
+				parsed.Tenant = value
+
+			case "user":
+				parsed.User = value
+
+			case "path":
+				kind, labelName, recognised := classifyPrometheusPath(value)
+				if !recognised {
+					return LogLine{}, ErrSkipLine
+				}
+				parsed.Kind = kind
+				parsed.LabelName = labelName
+
+			case "param_match[]":
+				parsed.Matchers = append(parsed.Matchers, value)
+
+			case "param_interval":
+				interval, err := ParseDuration(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid interval '%v': %w", value, err)
+				}
+				parsed.Interval = interval
+
+			case "param_timeout":
+				timeout, err := ParseDuration(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid timeout '%v': %w", value, err)
+				}
+				parsed.Timeout = timeout
+
+			case "param_lookback_delta":
+				lookbackDelta, err := ParseDuration(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid lookback delta '%v': %w", value, err)
+				}
+				parsed.LookbackDelta = lookbackDelta
+
+			case "param_stats":
+				parsed.Stats = value
+
+			case "param_time":
+				ts, err := ParseTime(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid query time '%v': %w", value, err)
+				}
+				parsed.QueryTime = ts
+
+			case "param_start":
+				ts, err := ParseTime(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid query start time '%v': %w", value, err)
+				}
+				parsed.QueryStartTime = ts
+
+			case "param_end":
+				ts, err := ParseTime(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid query end time '%v': %w", value, err)
+				}
+				parsed.QueryEndTime = ts
+
+			case "param_step":
+				step, err := ParseDuration(value)
+				if err != nil {
+					return LogLine{}, fmt.Errorf("invalid query step '%v': %w", value, err)
+				}
+				parsed.QueryStep = step
+			}
+		}
+	}
+
+	if parsed.Timestamp.IsZero() {
+		return LogLine{}, errors.New("no timestamp")
+	}
+
+	if err := parsed.validate(); err != nil {
+		return LogLine{}, err
+	}
+
+	return parsed, d.Err()
+}
+
+// classifyPrometheusPath determines the QueryKind represented by the "path" field of a Prometheus
+// query-frontend log line, along with the label name for /label/*/values requests (empty for
+// every other kind). recognised is false for any path that isn't one of the PromQL query API
+// endpoints this tool analyses (eg. /ready, /metrics), so the caller can skip the line.
+func classifyPrometheusPath(path string) (kind QueryKind, labelName string, recognised bool) {
+	const labelValuesPrefix = "/prometheus/api/v1/label/"
+	const labelValuesSuffix = "/values"
+
+	switch path {
+	case "/prometheus/api/v1/query":
+		return QueryKindInstant, "", true
+	case "/prometheus/api/v1/query_range":
+		return QueryKindRange, "", true
+	case "/prometheus/api/v1/series":
+		return QueryKindSeries, "", true
+	case "/prometheus/api/v1/labels":
+		return QueryKindLabels, "", true
+	case "/prometheus/api/v1/query_exemplars":
+		return QueryKindExemplars, "", true
+	case "/prometheus/api/v1/read":
+		return QueryKindRemoteRead, "", true
+	}
+
+	if len(path) > len(labelValuesPrefix)+len(labelValuesSuffix) &&
+		path[:len(labelValuesPrefix)] == labelValuesPrefix &&
+		path[len(path)-len(labelValuesSuffix):] == labelValuesSuffix {
+		name := path[len(labelValuesPrefix) : len(path)-len(labelValuesSuffix)]
+		return QueryKindLabelValues, name, true
+	}
+
+	return 0, "", false
+}
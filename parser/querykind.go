@@ -0,0 +1,62 @@
+package parser
+
+import "fmt"
+
+// QueryKind identifies which query API endpoint a log line represents.
+type QueryKind int
+
+const (
+	QueryKindInstant QueryKind = iota
+	QueryKindRange
+	QueryKindSeries
+	QueryKindLabels
+	QueryKindLabelValues
+	QueryKindExemplars
+	QueryKindRemoteRead
+
+	NumQueryKinds = QueryKindRemoteRead + 1
+)
+
+func (k QueryKind) String() string {
+	switch k {
+	case QueryKindInstant:
+		return "instant"
+	case QueryKindRange:
+		return "range"
+	case QueryKindSeries:
+		return "series"
+	case QueryKindLabels:
+		return "labels"
+	case QueryKindLabelValues:
+		return "label_values"
+	case QueryKindExemplars:
+		return "exemplars"
+	case QueryKindRemoteRead:
+		return "remote_read"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseQueryKind parses the string form produced by QueryKind.String, for use by flags such as
+// -query-type.
+func ParseQueryKind(s string) (QueryKind, error) {
+	switch s {
+	case "instant":
+		return QueryKindInstant, nil
+	case "range":
+		return QueryKindRange, nil
+	case "series":
+		return QueryKindSeries, nil
+	case "labels":
+		return QueryKindLabels, nil
+	case "label_values":
+		return QueryKindLabelValues, nil
+	case "exemplars":
+		return QueryKindExemplars, nil
+	case "remote_read":
+		return QueryKindRemoteRead, nil
+	default:
+		return 0, fmt.Errorf("unknown query kind %q", s)
+	}
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Format identifies a supported log format.
+type Format string
+
+const (
+	FormatPrometheus Format = "prometheus"
+	FormatLoki       Format = "loki"
+)
+
+// knownFormats lists every Format that Sniff tries, in priority order.
+var knownFormats = []Format{FormatPrometheus, FormatLoki}
+
+// New returns a Decoder for format.
+func New(format Format) (Decoder, error) {
+	switch format {
+	case FormatPrometheus:
+		return PrometheusDecoder{}, nil
+	case FormatLoki:
+		return LokiDecoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// Sniff inspects a single log line (typically the first line of a file) and returns whichever
+// known Format successfully decodes it, so callers don't need to be told the format up front. It
+// requires a genuine match (err == nil), not just ErrSkipLine, since an uninteresting line (eg. a
+// health check) can be validly skipped by every decoder and wouldn't tell formats apart.
+func Sniff(line []byte) (Format, error) {
+	for _, format := range knownFormats {
+		decoder, _ := New(format)
+
+		if _, err := decoder.Decode(line); err == nil {
+			return format, nil
+		}
+	}
+
+	return "", errors.New("could not determine log format: first line did not match any known decoder")
+}
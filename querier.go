@@ -3,15 +3,25 @@ package main
 import (
 	"context"
 	"github.com/prometheus/prometheus/model/labels"
+	"sync/atomic"
 	"time"
 )
 import "github.com/prometheus/prometheus/storage"
 
+// queryRangeCollectingQueryable is created fresh for each query that is analysed, so that
+// selectCount can be attributed back to the query that caused it even when many queries are
+// analysed concurrently.
 type queryRangeCollectingQueryable struct {
 	stats *statistics
 
 	// The time the query was executed.
 	queryTimestamp time.Time
+
+	// tenant is the tenant that issued the query, or "" if it couldn't be determined.
+	tenant string
+
+	// selectCount is the number of selects this query has caused so far.
+	selectCount atomic.Int64
 }
 
 func (q *queryRangeCollectingQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
@@ -22,7 +32,7 @@ func (q *queryRangeCollectingQueryable) Querier(ctx context.Context, mint, maxt
 
 	//fmt.Printf("Time range is %v ago to %v ago\n", from, to)
 
-	return &queryRangeCollectingQuerier{stats: q.stats, from: from, to: to}, nil
+	return &queryRangeCollectingQuerier{stats: q.stats, queryable: q, from: from, to: to}, nil
 }
 
 func int64MillisToTime(i int64) time.Time {
@@ -32,7 +42,8 @@ func int64MillisToTime(i int64) time.Time {
 var _ storage.Queryable = &queryRangeCollectingQueryable{}
 
 type queryRangeCollectingQuerier struct {
-	stats *statistics
+	stats     *statistics
+	queryable *queryRangeCollectingQueryable
 
 	from, to time.Duration
 }
@@ -40,6 +51,11 @@ type queryRangeCollectingQuerier struct {
 func (q *queryRangeCollectingQuerier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
 
 	q.stats.IncrementBlockRanges(q.from, q.to)
+	q.queryable.selectCount.Add(1)
+
+	if q.queryable.tenant != "" {
+		q.stats.forTenant(q.queryable.tenant).IncrementBlockRanges(q.from, q.to)
+	}
 
 	return storage.EmptySeriesSet()
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// wildcardToken is substituted for positions in a template that vary between the queries
+// belonging to a group.
+const wildcardToken = "<*>"
+
+// defaultDrainSimilarityThreshold is the minimum fraction of matching tokens required for a query
+// to be merged into an existing group rather than starting a new one.
+const defaultDrainSimilarityThreshold = 0.5
+
+// defaultDrainTreeDepth is the number of non-wildcard tokens used to route a query to a leaf,
+// beyond the initial branch on token count.
+const defaultDrainTreeDepth = 4
+
+var tokenPattern = regexp.MustCompile(`"[^"]*"|'[^']*'|[A-Za-z_:][A-Za-z0-9_:]*|[0-9]+(?:\.[0-9]+)?|[(){}\[\],]|!=|=~|!~|==|>=|<=|.`)
+
+// tokenizeQuery splits a PromQL query into a flat sequence of terminal tokens, approximating what
+// the PromQL lexer would produce, but without requiring a fully parseable expression.
+func tokenizeQuery(query string) []string {
+	matches := tokenPattern.FindAllString(query, -1)
+	tokens := make([]string, 0, len(matches))
+
+	for _, m := range matches {
+		if strings.TrimSpace(m) == "" {
+			continue
+		}
+
+		tokens = append(tokens, m)
+	}
+
+	return tokens
+}
+
+// drainGroup is a leaf-level cluster of structurally similar queries: a token template (with
+// wildcardToken standing in for positions that vary between its members) and the counts of
+// instant/range queries that have been merged into it.
+type drainGroup struct {
+	id           int
+	template     []string
+	instantCount int
+	rangeCount   int
+}
+
+func (g *drainGroup) recordQuery(isRangeQuery bool) {
+	if isRangeQuery {
+		g.rangeCount++
+	} else {
+		g.instantCount++
+	}
+}
+
+// drainNode is a node in the prefix tree: the root branches on token count, and each subsequent
+// level branches on the token at that position, down to treeDepth levels. Nodes at the maximum
+// depth (or nodes for token sequences shorter than the depth) hold the groups themselves.
+type drainNode struct {
+	children map[string]*drainNode
+	groups   []*drainGroup
+}
+
+func newDrainNode() *drainNode {
+	return &drainNode{children: map[string]*drainNode{}}
+}
+
+// drainTree implements a streaming Drain-style clustering tree: queries are tokenized and routed
+// through a fixed-depth prefix tree keyed on token count and the leading tokens, then merged into
+// the most similar group at that leaf if one is similar enough, or used to start a new group.
+type drainTree struct {
+	similarityThreshold float64
+	treeDepth           int
+
+	rootsByTokenCount map[int]*drainNode
+	nextGroupID       int
+}
+
+func newDrainTree(similarityThreshold float64, treeDepth int) *drainTree {
+	return &drainTree{
+		similarityThreshold: similarityThreshold,
+		treeDepth:           treeDepth,
+		rootsByTokenCount:   map[int]*drainNode{},
+	}
+}
+
+// Ingest routes tokens (as produced by tokenizeQuery) through the tree, and returns the group they
+// were merged into (creating a new one if no existing group at the leaf is similar enough).
+func (t *drainTree) Ingest(tokens []string, isRangeQuery bool) *drainGroup {
+	node, ok := t.rootsByTokenCount[len(tokens)]
+	if !ok {
+		node = newDrainNode()
+		t.rootsByTokenCount[len(tokens)] = node
+	}
+
+	depth := t.treeDepth
+	if depth > len(tokens) {
+		depth = len(tokens)
+	}
+
+	for i := 0; i < depth; i++ {
+		child, ok := node.children[tokens[i]]
+		if !ok {
+			child = newDrainNode()
+			node.children[tokens[i]] = child
+		}
+
+		node = child
+	}
+
+	group := node.bestMatch(tokens, t.similarityThreshold)
+	if group == nil {
+		group = &drainGroup{id: t.nextGroupID, template: append([]string(nil), tokens...)}
+		t.nextGroupID++
+		node.groups = append(node.groups, group)
+	} else {
+		group.merge(tokens)
+	}
+
+	group.recordQuery(isRangeQuery)
+
+	return group
+}
+
+// bestMatch returns the group at this node whose template is most similar to tokens, provided its
+// similarity meets threshold, or nil if no group qualifies.
+func (n *drainNode) bestMatch(tokens []string, threshold float64) *drainGroup {
+	var best *drainGroup
+	var bestSimilarity float64
+
+	for _, g := range n.groups {
+		similarity := g.similarity(tokens)
+
+		if similarity >= threshold && similarity > bestSimilarity {
+			best = g
+			bestSimilarity = similarity
+		}
+	}
+
+	return best
+}
+
+// similarity returns the fraction of positions in tokens that match the group's current template,
+// for same-length sequences. Sequences of differing length never match, since they are routed to
+// different branches of the tree by token count.
+func (g *drainGroup) similarity(tokens []string) float64 {
+	if len(tokens) != len(g.template) {
+		return 0
+	}
+
+	if len(tokens) == 0 {
+		return 1
+	}
+
+	matching := 0
+
+	for i, tok := range tokens {
+		if g.template[i] == wildcardToken || g.template[i] == tok {
+			matching++
+		}
+	}
+
+	return float64(matching) / float64(len(tokens))
+}
+
+// merge folds tokens into the group's template, replacing any position that doesn't match with
+// wildcardToken.
+func (g *drainGroup) merge(tokens []string) {
+	for i, tok := range tokens {
+		if g.template[i] != tok {
+			g.template[i] = wildcardToken
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainTreeIngest(t *testing.T) {
+	tree := newDrainTree(0.5, 4)
+
+	g1 := tree.Ingest(tokenizeQuery(`metric{label="a"}`), false)
+	g2 := tree.Ingest(tokenizeQuery(`metric{label="b"}`), false)
+	require.Equal(t, g1.id, g2.id, "queries differing only in a label value should merge into the same cluster")
+	require.Equal(t, []string{`metric`, `{`, `label`, `=`, `<*>`, `}`}, g1.template)
+	require.Equal(t, 2, g1.instantCount)
+	require.Equal(t, 0, g1.rangeCount)
+
+	g3 := tree.Ingest(tokenizeQuery(`other_metric{label="a"}`), true)
+	require.NotEqual(t, g1.id, g3.id, "queries with a different metric name should not merge")
+	require.Equal(t, 1, g3.rangeCount)
+
+	g4 := tree.Ingest(tokenizeQuery(`sum(metric{label="a"})`), false)
+	require.NotEqual(t, g1.id, g4.id, "queries with a different token count should not merge")
+}
+
+func TestDrainGroupSimilarity(t *testing.T) {
+	g := &drainGroup{template: []string{"a", "b", "c"}}
+
+	require.Equal(t, 1.0, g.similarity([]string{"a", "b", "c"}))
+	require.InDelta(t, 2.0/3.0, g.similarity([]string{"a", "x", "c"}), 0.0001)
+	require.Equal(t, float64(0), g.similarity([]string{"a", "b"}), "different-length token sequences never match")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+
+	logparser "github.com/charleskorn/query-log-analysis/parser"
+)
+
+var logFormatFlag = flag.String("log-format", "", "format of the log lines being analysed: prometheus or loki (default: auto-detect from the first line)")
+
+// resolveDecoder returns the logparser.Decoder that format names, or, if format is empty, sniffs
+// it from firstLine.
+func resolveDecoder(format logparser.Format, firstLine string) (logparser.Decoder, error) {
+	if format != "" {
+		return logparser.New(format)
+	}
+
+	sniffed, err := logparser.Sniff([]byte(firstLine))
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Detected log format", "format", sniffed)
+
+	return logparser.New(sniffed)
+}
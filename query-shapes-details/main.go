@@ -6,11 +6,25 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/prometheus/prometheus/promql/parser"
 	"io"
 	"log/slog"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/charleskorn/query-log-analysis/filter"
+	logparser "github.com/charleskorn/query-log-analysis/parser"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+var (
+	clusterQueries    = flag.Bool("cluster", false, "also cluster queries using Drain-style token-template clustering, in addition to AST-based cleaning")
+	clusterSimilarity = flag.Float64("cluster-similarity-threshold", defaultDrainSimilarityThreshold, "minimum token similarity required to merge a query into an existing cluster")
+	clusterTreeDepth  = flag.Int("cluster-tree-depth", defaultDrainTreeDepth, "number of leading tokens used to route a query through the clustering prefix tree")
+	concurrency       = flag.Int("concurrency", runtime.NumCPU(), "number of log lines to analyse concurrently")
 )
 
 func main() {
@@ -28,12 +42,17 @@ func run() error {
 		return errors.New("no paths specified")
 	}
 
+	lineFilter, err := filter.Build()
+	if err != nil {
+		return err
+	}
+
 	var results []queryInfo
 
 	for _, path := range paths {
 		slog.Info("Analysing file", "path", path)
 
-		fileResults, err := analyseFile(path)
+		fileResults, err := analyseFile(path, *concurrency, lineFilter)
 
 		if err != nil {
 			return fmt.Errorf("analysing file %v failed: %w", path, err)
@@ -55,11 +74,62 @@ func run() error {
 		}
 	}
 
+	if *clusterQueries {
+		if err := writeClusters(w, results); err != nil {
+			return err
+		}
+	}
+
 	w.Flush()
 
 	return w.Error()
 }
 
+// writeClusters groups results using Drain-style token-template clustering and appends a second
+// CSV section with one row per cluster: its ID, its token template, and how many instant/range
+// queries were merged into it.
+func writeClusters(w *csv.Writer, results []queryInfo) error {
+	tree := newDrainTree(*clusterSimilarity, *clusterTreeDepth)
+	groups := map[int]*drainGroup{}
+	var order []int
+
+	for _, q := range results {
+		tokens := tokenizeQuery(q.originalQuery)
+		group := tree.Ingest(tokens, q.queryType == "range")
+
+		if _, ok := groups[group.id]; !ok {
+			order = append(order, group.id)
+		}
+
+		groups[group.id] = group
+	}
+
+	if err := w.Write(nil); err != nil {
+		return err
+	}
+
+	if err := w.Write([]string{"Cluster ID", "Token template", "Instant queries", "Range queries"}); err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		g := groups[id]
+
+		row := []string{
+			strconv.Itoa(g.id),
+			strings.Join(g.template, " "),
+			strconv.Itoa(g.instantCount),
+			strconv.Itoa(g.rangeCount),
+		}
+
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type queryInfo struct {
 	timestamp     time.Time
 	originalQuery string
@@ -67,7 +137,11 @@ type queryInfo struct {
 	cleanedQuery  string
 }
 
-func analyseFile(path string) ([]queryInfo, error) {
+// analyseFile reads path one line at a time and fans parsed log lines out to a pool of
+// concurrency workers, each calling analyseLogLine, since that does the expensive PromQL
+// parse/clean work. Lines are parsed (cheaply) as they're read and pushed onto a bounded channel
+// so a slow worker pool can't let an unbounded number of parsed lines pile up in memory.
+func analyseFile(path string, concurrency int, lineFilter filter.Filter) ([]queryInfo, error) {
 	f, err := os.Open(path)
 
 	if err != nil {
@@ -76,10 +150,94 @@ func analyseFile(path string) ([]queryInfo, error) {
 
 	defer f.Close()
 
-	r := bufio.NewReader(f)
-	lineNumber := 0
+	lines := make(chan logparser.LogLine, concurrency)
+	stop := make(chan struct{})
+
+	var resultsMu sync.Mutex
 	var results []queryInfo
 
+	var workerErr error
+	var workerErrOnce sync.Once
+	var wg sync.WaitGroup
+
+	wg.Add(concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for l := range lines {
+				result, err := analyseLogLine(l)
+				if err != nil {
+					workerErrOnce.Do(func() {
+						workerErr = err
+						close(stop)
+					})
+
+					return
+				}
+
+				resultsMu.Lock()
+				results = append(results, result)
+				resultsMu.Unlock()
+			}
+		}()
+	}
+
+	var decoder logparser.Decoder
+
+	readErr := readLines(f, func(line string) error {
+		if decoder == nil {
+			decoder, err = resolveDecoder(logparser.Format(*logFormatFlag), line)
+			if err != nil {
+				return err
+			}
+		}
+
+		parsed, err := decoder.Decode([]byte(line))
+		if err != nil {
+			if errors.Is(err, logparser.ErrSkipLine) {
+				return nil
+			}
+
+			return fmt.Errorf("parsing log line '%v' failed: %w", line, err)
+		}
+
+		if !lineFilter.Matches(parsed) {
+			return nil
+		}
+
+		select {
+		case lines <- parsed:
+			return nil
+		case <-stop:
+			return errStoppedEarly
+		}
+	})
+
+	close(lines)
+	wg.Wait()
+
+	if workerErr != nil {
+		return nil, workerErr
+	}
+
+	if readErr != nil && readErr != errStoppedEarly {
+		return nil, readErr
+	}
+
+	return results, nil
+}
+
+// errStoppedEarly is a sentinel used internally by analyseFile to unwind readLines once a worker
+// has already failed; it is never returned to callers.
+var errStoppedEarly = errors.New("stopped early because a worker failed")
+
+// readLines reads from f one (potentially very long) line at a time, calling onLine for each one,
+// until EOF or onLine returns an error.
+func readLines(f io.Reader, onLine func(line string) error) error {
+	r := bufio.NewReader(f)
+
 	for {
 		l := ""
 
@@ -87,10 +245,10 @@ func analyseFile(path string) ([]queryInfo, error) {
 			portion, isPrefix, err := r.ReadLine()
 			if err != nil {
 				if err == io.EOF {
-					return results, nil
+					return nil
 				}
 
-				return nil, err
+				return err
 			}
 
 			l += string(portion)
@@ -100,58 +258,38 @@ func analyseFile(path string) ([]queryInfo, error) {
 			}
 		}
 
-		lineNumber++
-		result, skip, err := parseAndAnalyseLogLine(l)
-
-		if err != nil {
-			return nil, fmt.Errorf("line %v: %w", lineNumber, err)
-		}
-
-		if !skip {
-			results = append(results, result)
+		if err := onLine(l); err != nil {
+			return err
 		}
 	}
 }
 
-func parseAndAnalyseLogLine(line string) (queryInfo, bool, error) {
-	logLine, skip, err := parseLogLine(line)
-
-	if skip == true {
-		return queryInfo{}, true, nil
+func analyseLogLine(line logparser.LogLine) (queryInfo, error) {
+	info := queryInfo{
+		timestamp:     line.Timestamp,
+		originalQuery: line.Query,
+		queryType:     line.Kind.String(),
 	}
 
-	if err != nil {
-		return queryInfo{}, false, fmt.Errorf("parsing log line '%v' failed: %w", line, err)
+	if line.Query == "" {
+		// Nothing to clean: this is a series/labels/label_values/remote_read request, which
+		// doesn't carry a PromQL query.
+		return info, nil
 	}
 
-	info, err := analyseLogLine(logLine)
-	return info, false, err
-}
-
-func analyseLogLine(logLine logLine) (queryInfo, error) {
-	p := parser.NewParser(logLine.query)
+	p := parser.NewParser(line.Query)
 	defer p.Close()
 	expr, err := p.ParseExpr()
 
 	if err != nil {
-		return queryInfo{}, fmt.Errorf("could not parse query '%s': %w", logLine.query, err)
+		return queryInfo{}, fmt.Errorf("could not parse query '%s': %w", line.Query, err)
 	}
 
 	if err := cleanExpr(expr); err != nil {
-		return queryInfo{}, fmt.Errorf("could not clean query '%s': %w", logLine.query, err)
+		return queryInfo{}, fmt.Errorf("could not clean query '%s': %w", line.Query, err)
 	}
 
-	info := queryInfo{
-		timestamp:     logLine.timestamp,
-		originalQuery: logLine.query,
-		cleanedQuery:  expr.String(),
-	}
-
-	if logLine.isRangeQuery {
-		info.queryType = "range"
-	} else {
-		info.queryType = "instant"
-	}
+	info.cleanedQuery = expr.String()
 
 	return info, nil
 }
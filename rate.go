@@ -0,0 +1,115 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateResolution = time.Minute
+	defaultMaxRateBuckets = 10000
+	rateDownsampleFactor  = 10
+)
+
+// rateBucket holds the query/select counts observed in a single window of time.
+type rateBucket struct {
+	start      time.Time
+	resolution time.Duration
+	queries    int64
+	selects    int64
+}
+
+// rateSeries tracks queryCount/selectCount bucketed by time at a configurable resolution. Once the
+// number of retained buckets exceeds maxBuckets, the oldest half are downsampled in-place by
+// merging them in groups of rateDownsampleFactor, so memory stays bounded for long-running inputs
+// rather than growing with the time span covered by the logs.
+type rateSeries struct {
+	mu         sync.Mutex
+	resolution time.Duration
+	maxBuckets int
+	buckets    []rateBucket // ordered oldest to newest, non-overlapping
+}
+
+func newRateSeries(resolution time.Duration, maxBuckets int) *rateSeries {
+	return &rateSeries{resolution: resolution, maxBuckets: maxBuckets}
+}
+
+// Record adds one query, and the given number of selects it performed, to the bucket covering ts.
+// Calls may arrive with ts in any order (eg. from a pool of workers analysing lines concurrently),
+// so Record locates or creates the right bucket by binary search rather than assuming ts is always
+// newer than every bucket seen so far.
+func (r *rateSeries) Record(ts time.Time, selects int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bucketStart := ts.Truncate(r.resolution)
+
+	// i is the index of the first bucket that doesn't end before bucketStart, ie. the one that
+	// covers bucketStart if any does.
+	i := sort.Search(len(r.buckets), func(i int) bool {
+		b := r.buckets[i]
+		return b.start.Add(b.resolution).After(bucketStart)
+	})
+
+	if i < len(r.buckets) {
+		b := &r.buckets[i]
+
+		if !bucketStart.Before(b.start) {
+			b.queries++
+			b.selects += selects
+			return
+		}
+	}
+
+	r.buckets = slices.Insert(r.buckets, i, rateBucket{start: bucketStart, resolution: r.resolution, queries: 1, selects: selects})
+
+	if len(r.buckets) > r.maxBuckets {
+		r.downsampleOldestHalf()
+	}
+}
+
+// downsampleOldestHalf merges the oldest half of the retained buckets in groups of
+// rateDownsampleFactor, scaling their resolution up accordingly, and leaves the newest half as-is.
+func (r *rateSeries) downsampleOldestHalf() {
+	half := len(r.buckets) / 2
+	if half < rateDownsampleFactor {
+		return
+	}
+
+	merged := make([]rateBucket, 0, half/rateDownsampleFactor+1)
+
+	for i := 0; i < half; i += rateDownsampleFactor {
+		end := i + rateDownsampleFactor
+		if end > half {
+			end = half
+		}
+
+		group := r.buckets[i:end]
+		m := rateBucket{start: group[0].start, resolution: group[0].resolution * time.Duration(len(group))}
+
+		for _, b := range group {
+			m.queries += b.queries
+			m.selects += b.selects
+		}
+
+		merged = append(merged, m)
+	}
+
+	r.buckets = append(merged, r.buckets[half:]...)
+}
+
+// ForBuckets calls f once for each retained bucket, oldest first.
+func (r *rateSeries) ForBuckets(f func(start time.Time, resolution time.Duration, queries, selects int64) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, b := range r.buckets {
+		if err := f(b.start, b.resolution, b.queries, b.selects); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateSeriesRecord(t *testing.T) {
+	base := time.Date(2023, 11, 13, 9, 0, 0, 0, time.UTC)
+	r := newRateSeries(time.Minute, 10000)
+
+	r.Record(base, 2)
+	r.Record(base.Add(30*time.Second), 1)
+	r.Record(base.Add(time.Minute), 0)
+
+	var got []rateBucket
+	require.NoError(t, r.ForBuckets(func(start time.Time, resolution time.Duration, queries, selects int64) error {
+		got = append(got, rateBucket{start: start, resolution: resolution, queries: queries, selects: selects})
+		return nil
+	}))
+
+	require.Equal(t, []rateBucket{
+		{start: base, resolution: time.Minute, queries: 2, selects: 3},
+		{start: base.Add(time.Minute), resolution: time.Minute, queries: 1, selects: 0},
+	}, got)
+}
+
+func TestRateSeriesRecordToleratesOutOfOrderCalls(t *testing.T) {
+	base := time.Date(2023, 11, 13, 9, 0, 0, 0, time.UTC)
+	r := newRateSeries(time.Minute, 10000)
+
+	// A concurrent worker pool can call Record with timestamps in any order; the resulting buckets
+	// should be identical to recording them in order.
+	r.Record(base.Add(time.Minute), 0)
+	r.Record(base.Add(30*time.Second), 1)
+	r.Record(base, 2)
+
+	var got []rateBucket
+	require.NoError(t, r.ForBuckets(func(start time.Time, resolution time.Duration, queries, selects int64) error {
+		got = append(got, rateBucket{start: start, resolution: resolution, queries: queries, selects: selects})
+		return nil
+	}))
+
+	require.Equal(t, []rateBucket{
+		{start: base, resolution: time.Minute, queries: 2, selects: 3},
+		{start: base.Add(time.Minute), resolution: time.Minute, queries: 1, selects: 0},
+	}, got)
+}
+
+func TestRateSeriesDownsamplesOldestHalfWhenOverCapacity(t *testing.T) {
+	base := time.Date(2023, 11, 13, 9, 0, 0, 0, time.UTC)
+	r := newRateSeries(time.Minute, 20)
+
+	for i := 0; i < 21; i++ {
+		r.Record(base.Add(time.Duration(i)*time.Minute), 1)
+	}
+
+	var got []rateBucket
+	require.NoError(t, r.ForBuckets(func(start time.Time, resolution time.Duration, queries, selects int64) error {
+		got = append(got, rateBucket{start: start, resolution: resolution, queries: queries, selects: selects})
+		return nil
+	}))
+
+	// The oldest half (10 of the 21 buckets) should have been merged into a single 10-minute bucket.
+	require.Equal(t, base, got[0].start)
+	require.Equal(t, 10*time.Minute, got[0].resolution)
+	require.Equal(t, int64(10), got[0].queries)
+	require.Equal(t, int64(10), got[0].selects)
+
+	// The remaining 11 buckets should be untouched.
+	require.Len(t, got, 12)
+	require.Equal(t, time.Minute, got[1].resolution)
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charleskorn/query-log-analysis/parser"
+	"github.com/prometheus/client_golang/api"
+	apiv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// replayResult is the outcome of re-executing a single parser.LogLine against a live Prometheus API.
+type replayResult struct {
+	timestamp   time.Time
+	query       string
+	queryType   string // The parser.QueryKind's string form, eg. "instant", "range" or "series".
+	latency     time.Duration
+	seriesCount int
+	warnings    []string
+
+	// httpError is the error returned by the API call, or "" if it succeeded.
+	httpError string
+}
+
+// headerFlag is a flag.Value that accumulates repeated "-header Key: Value" arguments into a
+// http.Header.
+type headerFlag struct {
+	header http.Header
+}
+
+func (f *headerFlag) String() string {
+	return ""
+}
+
+func (f *headerFlag) Set(s string) error {
+	key, value, ok := splitHeader(s)
+	if !ok {
+		return fmt.Errorf("invalid header %q: expected 'Key: Value'", s)
+	}
+
+	if f.header == nil {
+		f.header = http.Header{}
+	}
+
+	f.header.Add(key, value)
+
+	return nil
+}
+
+func splitHeader(s string) (key, value string, ok bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' {
+			key = s[:i]
+			if key == "" {
+				return "", "", false
+			}
+
+			value = s[i+1:]
+			for len(value) > 0 && value[0] == ' ' {
+				value = value[1:]
+			}
+
+			return key, value, key != ""
+		}
+	}
+
+	return "", "", false
+}
+
+// headerRoundTripper injects a fixed set of headers (eg. X-Scope-OrgID, Authorization) into every
+// request before delegating to next.
+type headerRoundTripper struct {
+	header http.Header
+	next   http.RoundTripper
+}
+
+func (rt headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	for key, values := range rt.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	return rt.next.RoundTrip(req)
+}
+
+// runReplay implements the "replay" subcommand: it re-executes the queries in the log files named
+// by args against a live Prometheus API, so two backends (e.g. before/after an upgrade) can be
+// compared using the exact real-world query mix recorded in the log.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+
+	address := fs.String("address", "", "address of the Prometheus HTTP API to replay queries against")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "number of queries to replay concurrently")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for each replayed query")
+	timeShift := fs.Duration("time-shift", 0, "duration to add to every query's timestamps before replaying it")
+	anchorToNow := fs.Bool("anchor-to-now", false, "shift every query's timestamps so the first query in the log is replayed as if it were issued now, preserving the relative spacing between queries")
+	output := fs.String("output", "replay-report.tsv", "path to write the replay report to")
+	format := fs.String("format", "tsv", "format of the replay report: tsv or json")
+	logFormat := fs.String("log-format", "", "format of the log lines being replayed: prometheus or loki (default: auto-detect from the first line)")
+	sentinelModeFlag := fs.String("sentinel-mode", "clamp", "how to handle query log lines with a Prometheus MinTime/MaxTime (or similarly out-of-range) timestamp: clamp, drop or keep")
+	sentinelMinFlag := fs.String("sentinel-min", defaultSentinelBounds().Min.Format(time.RFC3339), "the earliest timestamp considered a real query time, rather than a sentinel")
+	sentinelMaxFlag := fs.String("sentinel-max", defaultSentinelBounds().Max.Format(time.RFC3339), "the latest timestamp considered a real query time, rather than a sentinel")
+	var headers headerFlag
+	fs.Var(&headers, "header", "an extra header to send with every request, as 'Key: Value' (can be repeated, eg. for tenant IDs or auth)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		return errors.New("no paths specified")
+	}
+
+	if *address == "" {
+		return errors.New("-address is required")
+	}
+
+	if *format != "tsv" && *format != "json" {
+		return fmt.Errorf("invalid -format %q: must be 'tsv' or 'json'", *format)
+	}
+
+	opts, err := ingestOptionsFromFlags(*logFormat, *sentinelModeFlag, *sentinelMinFlag, *sentinelMaxFlag)
+	if err != nil {
+		return err
+	}
+
+	client, err := api.NewClient(api.Config{
+		Address:      *address,
+		RoundTripper: headerRoundTripper{header: headers.header, next: http.DefaultTransport},
+	})
+
+	if err != nil {
+		return fmt.Errorf("could not create API client: %w", err)
+	}
+
+	v1api := apiv1.NewAPI(client)
+
+	var results []replayResult
+
+	for _, path := range paths {
+		slog.Info("Replaying file", "path", path)
+
+		fileResults, err := replayFile(path, v1api, *concurrency, *timeout, *timeShift, *anchorToNow, opts)
+		if err != nil {
+			return fmt.Errorf("replaying file %v failed: %w", path, err)
+		}
+
+		results = append(results, fileResults...)
+	}
+
+	slog.Info("Replay complete")
+
+	return writeReplayReport(*output, *format, results)
+}
+
+// replayFile reads path one line at a time and fans parsed log lines out to a pool of concurrency
+// workers, each replaying the query against api. Unlike analyseFile, a query that fails against the
+// live backend doesn't stop the replay early: its failure is recorded in the returned results so it
+// shows up in the report.
+func replayFile(path string, v1api apiv1.API, concurrency int, timeout, timeShift time.Duration, anchorToNow bool, opts ingestOptions) ([]replayResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+
+	defer f.Close()
+
+	lines := make(chan parser.LogLine, concurrency)
+
+	var resultsMu sync.Mutex
+	var results []replayResult
+	var wg sync.WaitGroup
+
+	wg.Add(concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for l := range lines {
+				result := replayLogLine(v1api, timeout, l)
+
+				resultsMu.Lock()
+				results = append(results, result)
+				resultsMu.Unlock()
+			}
+		}()
+	}
+
+	var decoder parser.Decoder
+	var shift time.Duration
+	var shiftComputed bool
+
+	readErr := readLines(f, func(line string) error {
+		if decoder == nil {
+			decoder, err = resolveDecoder(opts.format, line)
+			if err != nil {
+				return err
+			}
+		}
+
+		parsed, err := decoder.Decode([]byte(line))
+		if err != nil {
+			if errors.Is(err, parser.ErrSkipLine) {
+				return nil
+			}
+
+			return fmt.Errorf("parsing log line '%v' failed: %w", line, err)
+		}
+
+		parsed, keep := normalizeSentinelTimes(parsed, opts.sentinelMode, opts.sentinelBounds)
+		if !keep {
+			return nil
+		}
+
+		if anchorToNow {
+			if !shiftComputed {
+				shift = time.Since(parsed.Timestamp)
+				shiftComputed = true
+			}
+		} else {
+			shift = timeShift
+		}
+
+		parsed = shiftLogLineTimestamps(parsed, shift)
+
+		lines <- parsed
+
+		return nil
+	})
+
+	close(lines)
+	wg.Wait()
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return results, nil
+}
+
+// shiftLogLineTimestamps returns a copy of l with every timestamp field advanced by shift.
+func shiftLogLineTimestamps(l parser.LogLine, shift time.Duration) parser.LogLine {
+	l.Timestamp = l.Timestamp.Add(shift)
+	l.QueryTime = l.QueryTime.Add(shift)
+	l.QueryStartTime = l.QueryStartTime.Add(shift)
+	l.QueryEndTime = l.QueryEndTime.Add(shift)
+
+	return l
+}
+
+func replayLogLine(v1api apiv1.API, timeout time.Duration, l parser.LogLine) replayResult {
+	result := replayResult{
+		timestamp: l.Timestamp,
+		query:     l.Query,
+		queryType: l.Kind.String(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	count, warnings, err := replayByKind(ctx, v1api, l)
+	result.latency = time.Since(start)
+	result.warnings = warnings
+
+	if err != nil {
+		result.httpError = err.Error()
+		return result
+	}
+
+	result.seriesCount = count
+
+	return result
+}
+
+// replayByKind re-issues l against v1api using whichever API call matches its parser.QueryKind,
+// returning the number of series/label names/values in the result.
+func replayByKind(ctx context.Context, v1api apiv1.API, l parser.LogLine) (int, apiv1.Warnings, error) {
+	switch l.Kind {
+	case parser.QueryKindRange:
+		value, warnings, err := v1api.QueryRange(ctx, l.Query, apiv1.Range{Start: l.QueryStartTime, End: l.QueryEndTime, Step: l.QueryStep})
+		if err != nil {
+			return 0, warnings, err
+		}
+		return seriesCount(value), warnings, nil
+
+	case parser.QueryKindInstant:
+		value, warnings, err := v1api.Query(ctx, l.Query, l.QueryTime)
+		if err != nil {
+			return 0, warnings, err
+		}
+		return seriesCount(value), warnings, nil
+
+	case parser.QueryKindSeries:
+		sets, warnings, err := v1api.Series(ctx, l.Matchers, l.QueryStartTime, l.QueryEndTime)
+		if err != nil {
+			return 0, warnings, err
+		}
+		return len(sets), warnings, nil
+
+	case parser.QueryKindLabels:
+		names, warnings, err := v1api.LabelNames(ctx, l.Matchers, l.QueryStartTime, l.QueryEndTime)
+		if err != nil {
+			return 0, warnings, err
+		}
+		return len(names), warnings, nil
+
+	case parser.QueryKindLabelValues:
+		values, warnings, err := v1api.LabelValues(ctx, l.LabelName, l.Matchers, l.QueryStartTime, l.QueryEndTime)
+		if err != nil {
+			return 0, warnings, err
+		}
+		return len(values), warnings, nil
+
+	case parser.QueryKindExemplars:
+		results, err := v1api.QueryExemplars(ctx, l.Query, l.QueryStartTime, l.QueryEndTime)
+		if err != nil {
+			return 0, nil, err
+		}
+		return len(results), nil, nil
+
+	case parser.QueryKindRemoteRead:
+		return 0, nil, errors.New("replaying remote_read requests is not supported: the query log doesn't capture their matchers/time range")
+
+	default:
+		return 0, nil, fmt.Errorf("unknown query kind %v", l.Kind)
+	}
+}
+
+// seriesCount returns the number of series represented by v, regardless of its concrete type.
+func seriesCount(v model.Value) int {
+	switch v := v.(type) {
+	case model.Matrix:
+		return len(v)
+	case model.Vector:
+		return len(v)
+	case *model.Scalar, *model.String:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// writeReplayReport writes results to path in the given format ("tsv" or "json").
+func writeReplayReport(path, format string, results []replayResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create replay report: %w", err)
+	}
+
+	defer f.Close()
+
+	if format == "json" {
+		return writeReplayReportJSON(f, results)
+	}
+
+	return writeReplayReportTSV(f, results)
+}
+
+func writeReplayReportTSV(w io.Writer, results []replayResult) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = '\t'
+
+	header := []string{"timestamp", "query_type", "latency_ms", "series_count", "warnings", "http_error", "query"}
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		row := []string{
+			r.timestamp.Format(time.RFC3339Nano),
+			r.queryType,
+			strconv.FormatInt(r.latency.Milliseconds(), 10),
+			strconv.Itoa(r.seriesCount),
+			joinWarnings(r.warnings),
+			r.httpError,
+			r.query,
+		}
+
+		if err := csvWriter.Write(row); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+func joinWarnings(warnings apiv1.Warnings) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+
+	joined := warnings[0]
+	for _, w := range warnings[1:] {
+		joined += "; " + w
+	}
+
+	return joined
+}
+
+// replayReportEntry is the JSON representation of a replayResult.
+type replayReportEntry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Query       string    `json:"query"`
+	QueryType   string    `json:"query_type"`
+	LatencyMS   int64     `json:"latency_ms"`
+	SeriesCount int       `json:"series_count"`
+	Warnings    []string  `json:"warnings,omitempty"`
+	HTTPError   string    `json:"http_error,omitempty"`
+}
+
+func writeReplayReportJSON(w io.Writer, results []replayResult) error {
+	enc := json.NewEncoder(w)
+
+	for _, r := range results {
+		entry := replayReportEntry{
+			Timestamp:   r.timestamp,
+			Query:       r.query,
+			QueryType:   r.queryType,
+			LatencyMS:   r.latency.Milliseconds(),
+			SeriesCount: r.seriesCount,
+			Warnings:    r.warnings,
+			HTTPError:   r.httpError,
+		}
+
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
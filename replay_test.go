@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charleskorn/query-log-analysis/parser"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitHeader(t *testing.T) {
+	testCases := map[string]struct {
+		input string
+
+		expectedKey   string
+		expectedValue string
+		expectedOK    bool
+	}{
+		"simple":                {"X-Scope-OrgID: tenant-a", "X-Scope-OrgID", "tenant-a", true},
+		"no space after colon": {"Authorization:Bearer abc", "Authorization", "Bearer abc", true},
+		"no colon":             {"not a header", "", "", false},
+		"empty key":            {": value", "", "", false},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			key, value, ok := splitHeader(testCase.input)
+			require.Equal(t, testCase.expectedOK, ok)
+			require.Equal(t, testCase.expectedKey, key)
+			require.Equal(t, testCase.expectedValue, value)
+		})
+	}
+}
+
+func TestShiftLogLineTimestamps(t *testing.T) {
+	base := time.Date(2023, 11, 13, 9, 20, 0, 0, time.UTC)
+
+	l := parser.LogLine{
+		Timestamp:      base,
+		Kind:           parser.QueryKindRange,
+		QueryStartTime: base.Add(-time.Hour),
+		QueryEndTime:   base,
+		QueryTime:      base,
+	}
+
+	shifted := shiftLogLineTimestamps(l, time.Hour)
+
+	require.Equal(t, base.Add(time.Hour), shifted.Timestamp)
+	require.Equal(t, base, shifted.QueryStartTime)
+	require.Equal(t, base.Add(time.Hour), shifted.QueryEndTime)
+	require.Equal(t, base.Add(time.Hour), shifted.QueryTime)
+}
+
+func TestSeriesCount(t *testing.T) {
+	require.Equal(t, 2, seriesCount(model.Vector{{}, {}}))
+	require.Equal(t, 1, seriesCount(model.Matrix{{}}))
+	require.Equal(t, 1, seriesCount(&model.Scalar{}))
+	require.Equal(t, 1, seriesCount(&model.String{}))
+}
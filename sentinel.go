@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charleskorn/query-log-analysis/parser"
+)
+
+// sentinelMode controls how query log lines whose start/end/instant time falls outside
+// sentinelBounds are handled. Prometheus substitutes its MinTime/MaxTime placeholders (and
+// third-party stores like Promscale have shipped their own unbounded sentinels) for
+// series/labels/remote_read requests that don't specify a time range, and those billions-of-
+// seconds values would otherwise skew any aggregation over query time spans.
+type sentinelMode int
+
+const (
+	// sentinelClamp replaces an out-of-bounds time with whichever bound it crossed. This is the
+	// default, since it keeps the line (and its other fields) in the analysis while preventing a
+	// single sentinel from dominating duration/staleness statistics.
+	sentinelClamp sentinelMode = iota
+
+	// sentinelDrop discards the entire line.
+	sentinelDrop
+
+	// sentinelKeep keeps the line with its raw, out-of-bounds time untouched.
+	sentinelKeep
+)
+
+func parseSentinelMode(s string) (sentinelMode, error) {
+	switch s {
+	case "clamp":
+		return sentinelClamp, nil
+	case "drop":
+		return sentinelDrop, nil
+	case "keep":
+		return sentinelKeep, nil
+	default:
+		return 0, fmt.Errorf("unknown sentinel mode %q: must be 'clamp', 'drop' or 'keep'", s)
+	}
+}
+
+// sentinelBounds is the [Min, Max] window a query log line's start/end/instant time must fall
+// within to be treated as a real query time rather than a sentinel.
+type sentinelBounds struct {
+	Min, Max time.Time
+}
+
+// defaultSentinelBounds matches the fix Promscale applied for the same problem: anything before
+// 1970 or after 3000 is treated as a sentinel, not a real query time.
+func defaultSentinelBounds() sentinelBounds {
+	return sentinelBounds{
+		Min: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		Max: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (b sentinelBounds) contains(t time.Time) bool {
+	return !t.Before(b.Min) && !t.After(b.Max)
+}
+
+func (b sentinelBounds) clamp(t time.Time) time.Time {
+	if t.Before(b.Min) {
+		return b.Min
+	}
+
+	if t.After(b.Max) {
+		return b.Max
+	}
+
+	return t
+}
+
+// normalizeSentinelTimes applies mode to l's start/end/instant time fields (whichever its Kind
+// populates), returning the possibly-clamped line and whether it should be kept at all. A line
+// whose times are all within bounds is returned unchanged, regardless of mode.
+func normalizeSentinelTimes(l parser.LogLine, mode sentinelMode, bounds sentinelBounds) (parser.LogLine, bool) {
+	sentinel := false
+
+	if !l.QueryTime.IsZero() && !bounds.contains(l.QueryTime) {
+		sentinel = true
+	}
+
+	if !l.QueryStartTime.IsZero() && !bounds.contains(l.QueryStartTime) {
+		sentinel = true
+	}
+
+	if !l.QueryEndTime.IsZero() && !bounds.contains(l.QueryEndTime) {
+		sentinel = true
+	}
+
+	if !sentinel {
+		return l, true
+	}
+
+	switch mode {
+	case sentinelDrop:
+		return l, false
+
+	case sentinelKeep:
+		return l, true
+
+	default: // sentinelClamp
+		if !l.QueryTime.IsZero() {
+			l.QueryTime = bounds.clamp(l.QueryTime)
+		}
+
+		if !l.QueryStartTime.IsZero() {
+			l.QueryStartTime = bounds.clamp(l.QueryStartTime)
+		}
+
+		if !l.QueryEndTime.IsZero() {
+			l.QueryEndTime = bounds.clamp(l.QueryEndTime)
+		}
+
+		return l, true
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charleskorn/query-log-analysis/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeSentinelTimesLeavesInBoundsLinesUnchanged(t *testing.T) {
+	bounds := defaultSentinelBounds()
+	base := time.Date(2023, 11, 13, 9, 20, 0, 0, time.UTC)
+
+	l := parser.LogLine{
+		Kind:           parser.QueryKindRange,
+		QueryStartTime: base.Add(-time.Hour),
+		QueryEndTime:   base,
+	}
+
+	for _, mode := range []sentinelMode{sentinelClamp, sentinelDrop, sentinelKeep} {
+		normalized, keep := normalizeSentinelTimes(l, mode, bounds)
+		require.True(t, keep)
+		require.Equal(t, l, normalized)
+	}
+}
+
+func TestNormalizeSentinelTimesClampsOutOfBoundsRangeQuery(t *testing.T) {
+	bounds := defaultSentinelBounds()
+
+	l := parser.LogLine{
+		Kind:           parser.QueryKindRange,
+		QueryStartTime: parser.MinTime,
+		QueryEndTime:   time.Date(2023, 11, 13, 9, 20, 0, 0, time.UTC),
+	}
+
+	normalized, keep := normalizeSentinelTimes(l, sentinelClamp, bounds)
+	require.True(t, keep)
+	require.Equal(t, bounds.Min, normalized.QueryStartTime)
+	require.Equal(t, l.QueryEndTime, normalized.QueryEndTime)
+}
+
+func TestNormalizeSentinelTimesDropsOutOfBoundsLine(t *testing.T) {
+	bounds := defaultSentinelBounds()
+
+	l := parser.LogLine{
+		Kind:      parser.QueryKindInstant,
+		QueryTime: parser.MaxTime,
+	}
+
+	_, keep := normalizeSentinelTimes(l, sentinelDrop, bounds)
+	require.False(t, keep)
+}
+
+func TestNormalizeSentinelTimesKeepsRawOutOfBoundsLine(t *testing.T) {
+	bounds := defaultSentinelBounds()
+
+	l := parser.LogLine{
+		Kind:      parser.QueryKindInstant,
+		QueryTime: parser.MaxTime,
+	}
+
+	normalized, keep := normalizeSentinelTimes(l, sentinelKeep, bounds)
+	require.True(t, keep)
+	require.Equal(t, parser.MaxTime, normalized.QueryTime)
+}
+
+func TestParseSentinelMode(t *testing.T) {
+	testCases := map[string]sentinelMode{
+		"clamp": sentinelClamp,
+		"drop":  sentinelDrop,
+		"keep":  sentinelKeep,
+	}
+
+	for input, expected := range testCases {
+		mode, err := parseSentinelMode(input)
+		require.NoError(t, err)
+		require.Equal(t, expected, mode)
+	}
+
+	_, err := parseSentinelMode("bogus")
+	require.Error(t, err)
+}